@@ -1,5 +1,10 @@
 package d2common
 
+import (
+	"fmt"
+	"io"
+)
+
 type BitMuncher struct {
 	data     []byte
 	Offset   int
@@ -57,6 +62,18 @@ func (v *BitMuncher) GetBits(bits int) uint32 {
 	return result
 }
 
+// ReadBits returns the next bits, least significant bit first, or io.ErrUnexpectedEOF if fewer bits remain. Unlike
+// GetBits it does not panic on truncated data, and no bits are consumed on error.
+func (v *BitMuncher) ReadBits(bits int) (uint32, error) {
+	if bits < 0 || bits > 32 {
+		return 0, fmt.Errorf("can not read %d bits, expected 0 to 32", bits)
+	}
+	if v.Offset+bits > len(v.data)*8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return v.GetBits(bits), nil
+}
+
 func (v *BitMuncher) GetSignedBits(bits int) int {
 	return int(v.MakeSigned(v.GetBits(bits), bits))
 }
@@ -97,11 +97,29 @@ func (v *StreamReader) GetInt64() int64 {
 	return int64(result)
 }
 
-// ReadByte implements io.ByteReader
+// ReadByte implements io.ByteReader. It returns io.EOF at the end of the stream.
 func (v *StreamReader) ReadByte() (byte, error) {
+	if v.position >= v.GetSize() {
+		return 0, io.EOF
+	}
 	return v.GetByte(), nil
 }
 
+// ReadUInt32 returns a uint32 dword from the stream, or io.ErrUnexpectedEOF if fewer than 4 bytes remain. Unlike
+// GetUInt32 it does not panic on truncated data, and the position is only advanced on success.
+func (v *StreamReader) ReadUInt32() (uint32, error) {
+	if v.position+4 > v.GetSize() {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return v.GetUInt32(), nil
+}
+
+// ReadInt32 returns an int32 dword from the stream, or io.ErrUnexpectedEOF if fewer than 4 bytes remain
+func (v *StreamReader) ReadInt32() (int32, error) {
+	value, err := v.ReadUInt32()
+	return int32(value), err
+}
+
 // ReadBytes reads multiple bytes
 func (v *StreamReader) ReadBytes(count int) ([]byte, error) {
 	result := make([]byte, count)
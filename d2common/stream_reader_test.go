@@ -1,6 +1,7 @@
 package d2common
 
 import (
+	"io"
 	"testing"
 )
 
@@ -54,3 +55,35 @@ func TestStreamReaderDword(t *testing.T) {
 		t.Fatalf("StreamReader.GetPosition() should be at %d, but was at %d instead", 4, pos)
 	}
 }
+
+func TestStreamReaderBounds(t *testing.T) {
+	sr := CreateStreamReader([]byte{0x78, 0x56, 0x34, 0x12, 0xFF})
+	if value, err := sr.ReadUInt32(); err != nil || value != 0x12345678 {
+		t.Fatalf("StreamReader.ReadUInt32() was expected to return %X, but returned %X (%v) instead", 0x12345678, value, err)
+	}
+	if _, err := sr.ReadInt32(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("StreamReader.ReadInt32() was expected to fail on truncated data, but returned %v instead", err)
+	}
+	if pos := sr.GetPosition(); pos != 4 {
+		t.Fatalf("StreamReader.GetPosition() should be at 4 after a failed read, but was at %d instead", pos)
+	}
+	if b, err := sr.ReadByte(); err != nil || b != 0xFF {
+		t.Fatalf("StreamReader.ReadByte() was expected to return FF, but returned %X (%v) instead", b, err)
+	}
+	if _, err := sr.ReadByte(); err != io.EOF {
+		t.Fatalf("StreamReader.ReadByte() was expected to return io.EOF, but returned %v instead", err)
+	}
+}
+
+func TestBitMuncherReadBits(t *testing.T) {
+	bm := CreateBitMuncher([]byte{0xA5, 0x01}, 0)
+	if value, err := bm.ReadBits(12); err != nil || value != 0x1A5 {
+		t.Fatalf("BitMuncher.ReadBits() was expected to return %X, but returned %X (%v) instead", 0x1A5, value, err)
+	}
+	if _, err := bm.ReadBits(5); err != io.ErrUnexpectedEOF {
+		t.Fatalf("BitMuncher.ReadBits() was expected to fail past the end, but returned %v instead", err)
+	}
+	if value, err := bm.ReadBits(4); err != nil || value != 0 || bm.Offset != 16 {
+		t.Fatalf("BitMuncher.ReadBits() was expected to read the remaining bits, but returned %X (%v) instead", value, err)
+	}
+}
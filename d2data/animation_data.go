@@ -36,7 +36,7 @@ func LoadAnimationData(fileProvider d2interface.FileProvider) {
 		for i := 0; i < dataCount; i++ {
 			cofNameBytes, _ := streamReader.ReadBytes(8)
 			data := &AnimationDataRecord{
-				COFName:            strings.ReplaceAll(string(cofNameBytes), string(0), ""),
+				COFName:            strings.ReplaceAll(string(cofNameBytes), "\x00", ""),
 				FramesPerDirection: int(streamReader.GetInt32()),
 				AnimationSpeed:     int(streamReader.GetInt32()),
 			}
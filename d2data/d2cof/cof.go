@@ -41,7 +41,7 @@ func LoadCOF(fileName string, fileProvider d2interface.FileProvider) *COF {
 		layer.Transparent = streamReader.GetByte() != 0
 		layer.DrawEffect = d2enum.DrawEffect(streamReader.GetByte())
 		weaponClassStr, _ := streamReader.ReadBytes(4)
-		layer.WeaponClass = d2enum.WeaponClassFromString(strings.TrimSpace(strings.ReplaceAll(string(weaponClassStr), string(0), "")))
+		layer.WeaponClass = d2enum.WeaponClassFromString(strings.TrimSpace(strings.ReplaceAll(string(weaponClassStr), "\x00", "")))
 		result.CofLayers[i] = layer
 		result.CompositeLayers[layer.Type] = i
 	}
@@ -58,7 +58,8 @@ func LoadCOF(fileName string, fileProvider d2interface.FileProvider) *COF {
 		for frame := 0; frame < result.FramesPerDirection; frame++ {
 			result.Priority[direction][frame] = make([]d2enum.CompositeType, result.NumberOfLayers)
 			for i := 0; i < result.NumberOfLayers; i++ {
-				result.Priority[direction][frame][i] = d2enum.CompositeType(priorityBytes[i])
+				priorityIndex := (((direction * result.FramesPerDirection) + frame) * result.NumberOfLayers) + i
+				result.Priority[direction][frame][i] = d2enum.CompositeType(priorityBytes[priorityIndex])
 			}
 		}
 	}
@@ -0,0 +1,91 @@
+package d2cof
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+type testFileProvider map[string][]byte
+
+func (v testFileProvider) LoadFile(fileName string) []byte {
+	return v[fileName]
+}
+
+// testSprite is a layer that draws the same image in every frame
+type testSprite struct {
+	image *image.RGBA
+}
+
+func newTestSprite(width int, c color.RGBA) testSprite {
+	img := image.NewRGBA(image.Rect(0, 0, width, 1))
+	for x := 0; x < width; x++ {
+		img.SetRGBA(x, 0, c)
+	}
+	return testSprite{image: img}
+}
+
+func (v testSprite) FrameImage(direction, frame int, palette d2datadict.PaletteRec) (*image.RGBA, image.Point, error) {
+	return v.image, image.Point{}, nil
+}
+
+// encodeTestCOF encodes a COF with one direction of two frames. The head and torso are opaque, the legs are drawn
+// with the screen effect, and the right arm has no sprite. The torso is drawn over the head in the first frame, and
+// the head over the torso in the second.
+func encodeTestCOF() []byte {
+	data := []byte{4, 2, 1}
+	data = append(data, make([]byte, 25)...)
+	layers := []struct {
+		compositeType d2enum.CompositeType
+		transparent   byte
+		drawEffect    byte
+	}{
+		{d2enum.CompositeTypeHead, 0, 0},
+		{d2enum.CompositeTypeTorso, 0, 0},
+		{d2enum.CompositeTypeLegs, 1, d2enum.DrawEffectScreen},
+		{d2enum.CompositeTypeRightArm, 0, 0},
+	}
+	for _, layer := range layers {
+		data = append(data, byte(layer.compositeType), 0, 0, layer.transparent, layer.drawEffect, 'h', 't', 'h', 0)
+	}
+	data = append(data, 0, 0) // Animation frames
+	data = append(data,
+		byte(d2enum.CompositeTypeRightArm), byte(d2enum.CompositeTypeHead), byte(d2enum.CompositeTypeTorso),
+		byte(d2enum.CompositeTypeLegs),
+		byte(d2enum.CompositeTypeTorso), byte(d2enum.CompositeTypeHead), byte(d2enum.CompositeTypeRightArm),
+		byte(d2enum.CompositeTypeLegs))
+	return data
+}
+
+func TestComposite(t *testing.T) {
+	cof := LoadCOF("test.cof", testFileProvider{"test.cof": encodeTestCOF()})
+	sprites := map[d2enum.CompositeType]LayerSprite{
+		d2enum.CompositeTypeHead:  newTestSprite(1, color.RGBA{R: 200, A: 255}),
+		d2enum.CompositeTypeTorso: newTestSprite(1, color.RGBA{G: 200, A: 255}),
+		d2enum.CompositeTypeLegs:  newTestSprite(2, color.RGBA{B: 100, A: 255}),
+	}
+	expected := [][]color.RGBA{
+		{{G: 200, B: 100, A: 255}, {B: 100, A: 255}},
+		{{R: 200, B: 100, A: 255}, {B: 100, A: 255}},
+	}
+	for frame, pixels := range expected {
+		img, err := Composite(cof, sprites, d2datadict.PaletteRec{}, 0, frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds() != image.Rect(0, 0, 2, 1) {
+			t.Fatalf("Expected the bounds of the widest layer, got %v", img.Bounds())
+		}
+		for x, pixel := range pixels {
+			if actual := img.RGBAAt(x, 0); actual != pixel {
+				t.Fatalf("Expected pixel %d of frame %d to be %v, got %v", x, frame, pixel, actual)
+			}
+		}
+	}
+	if _, err := Composite(cof, sprites, d2datadict.PaletteRec{}, 0, 2); err == nil {
+		t.Fatal("Expected an error for a frame out of range")
+	}
+}
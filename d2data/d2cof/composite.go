@@ -0,0 +1,116 @@
+package d2cof
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+// LayerSprite is a sprite, such as a DC6 or DCC file, that is drawn as one layer of a composite
+type LayerSprite interface {
+	// FrameImage renders a frame with the palette, and returns it with the position of its top left corner relative
+	// to the sprite origin
+	FrameImage(direction, frame int, palette d2datadict.PaletteRec) (*image.RGBA, image.Point, error)
+}
+
+// Composite draws the layers of a frame in the order the COF specifies for it. The bounds of the returned image are
+// relative to the sprite origin. Layers without a sprite in the map are skipped.
+func Composite(cof *COF, sprites map[d2enum.CompositeType]LayerSprite, palette d2datadict.PaletteRec,
+	direction, frame int) (*image.RGBA, error) {
+	if direction < 0 || direction >= cof.NumberOfDirections || frame < 0 || frame >= cof.FramesPerDirection {
+		return nil, fmt.Errorf("frame %d of direction %d is out of range", frame, direction)
+	}
+
+	type layerImage struct {
+		image  *image.RGBA
+		bounds image.Rectangle
+		layer  CofLayer
+	}
+	layers := make([]layerImage, 0, cof.NumberOfLayers)
+	bounds := image.Rectangle{}
+	for _, compositeType := range cof.Priority[direction][frame] {
+		sprite, ok := sprites[compositeType]
+		if !ok || sprite == nil {
+			continue
+		}
+		layerIndex, ok := cof.CompositeLayers[compositeType]
+		if !ok {
+			continue
+		}
+		img, origin, err := sprite.FrameImage(direction, frame, palette)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %v", compositeType, err)
+		}
+		layerBounds := img.Bounds().Sub(img.Bounds().Min).Add(origin)
+		layers = append(layers, layerImage{image: img, bounds: layerBounds, layer: cof.CofLayers[layerIndex]})
+		bounds = bounds.Union(layerBounds)
+	}
+
+	result := image.NewRGBA(bounds)
+	for _, layer := range layers {
+		drawLayer(result, layer.image, layer.bounds.Min, layer.layer)
+	}
+	return result, nil
+}
+
+// drawLayer blends the layer into the destination using the layer's draw effect. The screen, luminance and bright
+// alpha blending effects are all approximated with additive blending.
+func drawLayer(dst, src *image.RGBA, at image.Point, layer CofLayer) {
+	opacity := 255
+	additive := false
+	if layer.Transparent {
+		switch layer.DrawEffect {
+		case d2enum.DrawEffectPctTransparency75:
+			opacity = 64
+		case d2enum.DrawEffectPctTransparency50:
+			opacity = 128
+		case d2enum.DrawEffectPctTransparency25:
+			opacity = 192
+		case d2enum.DrawEffectScreen, d2enum.DrawEffectLuminance, d2enum.DrawEffectBringAlphaBlending:
+			additive = true
+		}
+	}
+	srcBounds := src.Bounds()
+	for y := 0; y < srcBounds.Dy(); y++ {
+		for x := 0; x < srcBounds.Dx(); x++ {
+			srcOffset := src.PixOffset(srcBounds.Min.X+x, srcBounds.Min.Y+y)
+			alpha := int(src.Pix[srcOffset+3])
+			if alpha == 0 {
+				continue
+			}
+			dstOffset := dst.PixOffset(at.X+x, at.Y+y)
+			for c := 0; c < 3; c++ {
+				srcValue := int(src.Pix[srcOffset+c])
+				dstValue := int(dst.Pix[dstOffset+c])
+				if additive {
+					dst.Pix[dstOffset+c] = clampByte(dstValue + srcValue)
+				} else {
+					weight := (alpha * opacity) / 255
+					dst.Pix[dstOffset+c] = clampByte(((srcValue * weight) + (dstValue * (255 - weight))) / 255)
+				}
+			}
+			dstAlpha := int(dst.Pix[dstOffset+3])
+			if additive {
+				// Light adds to what is below it, so the pixel is at least as opaque as the layer
+				if alpha > dstAlpha {
+					dst.Pix[dstOffset+3] = uint8(alpha)
+				}
+			} else {
+				weight := (alpha * opacity) / 255
+				dst.Pix[dstOffset+3] = clampByte(weight + ((dstAlpha * (255 - weight)) / 255))
+			}
+		}
+	}
+}
+
+func clampByte(value int) uint8 {
+	if value > 255 {
+		return 255
+	}
+	if value < 0 {
+		return 0
+	}
+	return uint8(value)
+}
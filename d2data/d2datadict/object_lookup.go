@@ -44,13 +44,21 @@ type ObjectLookupRecord struct {
 }
 
 func LookupObject(act, typ, id int) *ObjectLookupRecord {
+	lookup := FindObjectLookup(act, typ, id)
+	if lookup == nil {
+		log.Panicf("Failed to look up object Act: %d, Type: %d, Id: %d", act, typ, id)
+	}
+	return lookup
+}
+
+// FindObjectLookup returns the lookup record of the object placed in a map of the act, or nil if there is none
+func FindObjectLookup(act, typ, id int) *ObjectLookupRecord {
 	for _, lookup := range ObjectLookups {
 		if lookup.Act != act || int(lookup.Type) != typ || lookup.Id != id {
 			continue
 		}
 		return &lookup
 	}
-	log.Panicf("Failed to look up object Act: %d, Type: %d, Id: %d", act, typ, id)
 	return nil
 }
 
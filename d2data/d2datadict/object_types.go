@@ -27,8 +27,8 @@ func LoadObjectTypes(fileProvider d2interface.FileProvider) {
 		nameBytes, _ := streamReader.ReadBytes(32)
 		tokenBytes, _ := streamReader.ReadBytes(20)
 		ObjectTypes[i] = ObjectTypeRecord{
-			Name:  strings.TrimSpace(strings.ReplaceAll(string(nameBytes), string(0), "")),
-			Token: strings.TrimSpace(strings.ReplaceAll(string(tokenBytes), string(0), "")),
+			Name:  strings.TrimSpace(strings.ReplaceAll(string(nameBytes), "\x00", "")),
+			Token: strings.TrimSpace(strings.ReplaceAll(string(tokenBytes), "\x00", "")),
 		}
 	}
 	log.Printf("Loaded %d object types", len(ObjectTypes))
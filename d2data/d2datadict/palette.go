@@ -1,11 +1,18 @@
 package d2datadict
 
 import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
 	"log"
+	"sync"
 
 	"github.com/OpenDiablo2/D2Shared/d2common/d2interface"
 
 	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2mpq"
 )
 
 // PaletteRGB represents a color in a palette
@@ -35,16 +42,185 @@ func CreatePalette(name d2enum.PaletteType, data []byte) PaletteRec {
 	return result
 }
 
+// paletteColorCount is the number of colors in a palette, each stored as 3 bytes in pal.dat files
+const paletteColorCount = 256
+
+// PaletteOptions configures how palette data is loaded
+type PaletteOptions struct {
+	// Tolerant accepts data that does not hold exactly 256 colors. Missing colors are black and extra data is ignored.
+	Tolerant bool
+}
+
+// LoadPalette creates a palette from pal.dat data, returning an error unless the data holds exactly 256 colors
+func LoadPalette(name d2enum.PaletteType, data []byte) (PaletteRec, error) {
+	return LoadPaletteWithOptions(name, data, PaletteOptions{})
+}
+
+// LoadPaletteWithOptions creates a palette from pal.dat data using the given options
+func LoadPaletteWithOptions(name d2enum.PaletteType, data []byte, options PaletteOptions) (PaletteRec, error) {
+	expectedLength := paletteColorCount * 3
+	if len(data) != expectedLength {
+		if !options.Tolerant {
+			return PaletteRec{}, fmt.Errorf("palette %s has %d bytes (%d colors), expected %d bytes",
+				name, len(data), len(data)/3, expectedLength)
+		}
+		fixed := make([]byte, expectedLength)
+		copy(fixed, data)
+		data = fixed
+	}
+	return CreatePalette(name, data), nil
+}
+
 func LoadPalettes(mpqFiles map[string]string, fileProvider d2interface.FileProvider) {
 	Palettes = make(map[d2enum.PaletteType]PaletteRec)
 	for _, pal := range []string{
 		"act1", "act2", "act3", "act4", "act5", "endgame", "endgame2", "fechar", "loading",
 		"menu0", "menu1", "menu2", "menu3", "menu4", "sky", "static", "trademark", "units",
 	} {
-		filePath := `data\global\palette\` + pal + `\pal.dat`
 		paletteName := d2enum.PaletteType(pal)
-		palette := CreatePalette(paletteName, fileProvider.LoadFile(filePath))
-		Palettes[paletteName] = palette
+		Palettes[paletteName] = CreatePalette(paletteName, fileProvider.LoadFile(palettePath(paletteName)))
 	}
 	log.Printf("Loaded %d palettes", len(Palettes))
 }
+
+// LoadPaletteFromMPQ loads the palette with the given name, such as d2enum.Act1 or d2enum.Units, from
+// data\global\palette\<name>\pal.dat in the archive. The palette is not cached.
+func LoadPaletteFromMPQ(mpq *d2mpq.MPQ, name d2enum.PaletteType) (PaletteRec, error) {
+	data, err := mpq.ReadFile(palettePath(name))
+	if err != nil {
+		return PaletteRec{}, fmt.Errorf("unable to read palette %s: %v", name, err)
+	}
+	return LoadPalette(name, data)
+}
+
+// The palette cache is shared by all goroutines. Lookups take a read lock, so concurrent renderers do not block each
+// other once a palette is cached.
+var (
+	paletteCacheMutex sync.RWMutex
+	paletteCache      = make(map[d2enum.PaletteType]PaletteRec)
+)
+
+// palettePath returns the path of the palette file with the given name
+func palettePath(name d2enum.PaletteType) string {
+	return `data\global\palette\` + string(name) + `\pal.dat`
+}
+
+// GetPalette returns the palette with the given name, loading it from data\global\palette\<name>\pal.dat on first
+// use. It is safe to call from multiple goroutines. Two goroutines that miss the cache at the same time may both load
+// the palette, but the same palette ends up cached.
+func GetPalette(name d2enum.PaletteType, fileProvider d2interface.FileProvider) PaletteRec {
+	paletteCacheMutex.RLock()
+	palette, ok := paletteCache[name]
+	paletteCacheMutex.RUnlock()
+	if ok {
+		return palette
+	}
+	palette = CreatePalette(name, fileProvider.LoadFile(palettePath(name)))
+	paletteCacheMutex.Lock()
+	paletteCache[name] = palette
+	paletteCacheMutex.Unlock()
+	return palette
+}
+
+// ClearPaletteCache drops all cached palettes, so the next GetPalette loads them again. It is safe to call while other
+// goroutines use the cache.
+func ClearPaletteCache() {
+	paletteCacheMutex.Lock()
+	paletteCache = make(map[d2enum.PaletteType]PaletteRec)
+	paletteCacheMutex.Unlock()
+}
+
+// Lerp blends every color of the palette towards the other palette. A t of 0 returns this palette and a t of 1 returns
+// the colors of the other one; values outside of that range are clamped. The name of this palette is kept.
+func (v PaletteRec) Lerp(to PaletteRec, t float64) PaletteRec {
+	if t <= 0 || v.Colors == to.Colors {
+		return v
+	}
+	if t > 1 {
+		t = 1
+	}
+	result := PaletteRec{Name: v.Name}
+	for i, from := range v.Colors {
+		result.Colors[i] = PaletteRGB{
+			R: lerpChannel(from.R, to.Colors[i].R, t),
+			G: lerpChannel(from.G, to.Colors[i].G, t),
+			B: lerpChannel(from.B, to.Colors[i].B, t),
+		}
+	}
+	return result
+}
+
+func lerpChannel(from, to uint8, t float64) uint8 {
+	value := float64(from) + ((float64(to) - float64(from)) * t) + 0.5
+	if value < 0 {
+		return 0
+	}
+	if value > 255 {
+		return 255
+	}
+	return uint8(value)
+}
+
+// NearestIndex returns the index of the palette color closest to the given color, by squared distance
+func (v PaletteRec) NearestIndex(r, g, b uint8) int {
+	result := 0
+	bestDistance := -1
+	for i, paletteColor := range v.Colors {
+		dr := int(paletteColor.R) - int(r)
+		dg := int(paletteColor.G) - int(g)
+		db := int(paletteColor.B) - int(b)
+		distance := (dr * dr) + (dg * dg) + (db * db)
+		if bestDistance < 0 || distance < bestDistance {
+			result = i
+			bestDistance = distance
+			if distance == 0 {
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Quantize maps every pixel of the image, row by row, to the nearest palette index. Fully transparent pixels are -1.
+func (v PaletteRec) Quantize(img image.Image) []int16 {
+	bounds := img.Bounds()
+	result := make([]int16, 0, bounds.Dx()*bounds.Dy())
+	lookup := make(map[color.NRGBA]int16)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if pixel.A == 0 {
+				result = append(result, -1)
+				continue
+			}
+			pixel.A = 0xFF
+			index, ok := lookup[pixel]
+			if !ok {
+				index = int16(v.NearestIndex(pixel.R, pixel.G, pixel.B))
+				lookup[pixel] = index
+			}
+			result = append(result, index)
+		}
+	}
+	return result
+}
+
+// EncodeACT writes the palette in the Adobe Color Table format, which is 256 RGB triplets (768 bytes)
+func (v PaletteRec) EncodeACT(w io.Writer) error {
+	data := make([]byte, 0, len(v.Colors)*3)
+	for _, paletteColor := range v.Colors {
+		data = append(data, paletteColor.R, paletteColor.G, paletteColor.B)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// EncodeGPL writes the palette in the GIMP palette text format
+func (v PaletteRec) EncodeGPL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "GIMP Palette\nName: %s\nColumns: 16\n#\n", v.Name)
+	for i, paletteColor := range v.Colors {
+		fmt.Fprintf(bw, "%3d %3d %3d\tIndex %d\n", paletteColor.R, paletteColor.G, paletteColor.B, i)
+	}
+	return bw.Flush()
+}
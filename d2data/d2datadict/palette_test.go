@@ -0,0 +1,160 @@
+package d2datadict
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2mpq"
+)
+
+// testPaletteData returns pal.dat data for the given number of colors, where every byte is its offset
+func testPaletteData(colors int) []byte {
+	data := make([]byte, colors*3)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+// countingFileProvider serves files from a map and counts the loads of every file
+type countingFileProvider struct {
+	files map[string][]byte
+	loads map[string]int
+}
+
+func (v *countingFileProvider) LoadFile(fileName string) []byte {
+	v.loads[fileName]++
+	return v.files[fileName]
+}
+
+func TestLoadPalette(t *testing.T) {
+	for _, colors := range []int{255, 256, 257} {
+		palette, err := LoadPalette(d2enum.Act1, testPaletteData(colors))
+		if (err == nil) != (colors == paletteColorCount) {
+			t.Fatalf("Expected only 256 colors to load strictly, got %v for %d colors", err, colors)
+		}
+		if err == nil && (palette.Name != d2enum.Act1 || palette.Colors[1] != (PaletteRGB{R: 5, G: 4, B: 3})) {
+			t.Fatalf("Expected the colors to be read as BGR, got %v", palette.Colors[1])
+		}
+		palette, err = LoadPaletteWithOptions(d2enum.Act1, testPaletteData(colors), PaletteOptions{Tolerant: true})
+		if err != nil {
+			t.Fatalf("Expected %d colors to load tolerantly, got %v", colors, err)
+		}
+		last := PaletteRGB{R: 255, G: 254, B: 253}
+		if colors < paletteColorCount {
+			last = PaletteRGB{}
+		}
+		if palette.Colors[254] != (PaletteRGB{R: 252, G: 251, B: 250}) || palette.Colors[255] != last {
+			t.Fatalf("Expected the last color of %d colors to be %v, got %v", colors, last, palette.Colors[255])
+		}
+	}
+}
+
+func TestLerp(t *testing.T) {
+	from, _ := LoadPalette(d2enum.Act1, testPaletteData(256))
+	to := PaletteRec{Name: d2enum.Units}
+	to.Colors[1] = PaletteRGB{R: 255, G: 255, B: 255}
+	if from.Lerp(to, 0) != from {
+		t.Fatal("Expected t of 0 to return the palette")
+	}
+	if result := from.Lerp(to, 1); result.Colors != to.Colors || result.Name != d2enum.Act1 {
+		t.Fatalf("Expected t of 1 to return the other colors under the same name, got %v", result.Name)
+	}
+	if result := from.Lerp(to, 0.5); result.Colors[1] != (PaletteRGB{R: 130, G: 130, B: 129}) {
+		t.Fatalf("Expected the colors to be blended halfway, got %v", result.Colors[1])
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	palette := PaletteRec{}
+	palette.Colors[1] = PaletteRGB{R: 255}
+	palette.Colors[2] = PaletteRGB{G: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 250, G: 10, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{G: 200, A: 128})
+	img.SetNRGBA(2, 0, color.NRGBA{R: 255, A: 0})
+	indices := palette.Quantize(img)
+	if len(indices) != 3 || indices[0] != 1 || indices[1] != 2 || indices[2] != -1 {
+		t.Fatalf("Expected the nearest colors and -1 for the transparent pixel, got %v", indices)
+	}
+}
+
+func TestEncodePalette(t *testing.T) {
+	palette, _ := LoadPalette(d2enum.Act1, testPaletteData(256))
+	buffer := new(bytes.Buffer)
+	if err := palette.EncodeACT(buffer); err != nil {
+		t.Fatal(err)
+	}
+	if buffer.Len() != 768 || !bytes.Equal(buffer.Bytes()[3:6], []byte{5, 4, 3}) {
+		t.Fatalf("Expected 768 bytes of RGB triplets, got %d bytes", buffer.Len())
+	}
+	buffer.Reset()
+	if err := palette.EncodeGPL(buffer); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	if len(lines) != 4+256 || lines[0] != "GIMP Palette" || lines[1] != "Name: act1" ||
+		lines[5] != "  5   4   3\tIndex 1" {
+		t.Fatalf("Expected a GIMP palette of 256 colors, got %d lines", len(lines))
+	}
+}
+
+func TestGetPalette(t *testing.T) {
+	ClearPaletteCache()
+	defer ClearPaletteCache()
+	path := palettePath(d2enum.Units)
+	fileProvider := &countingFileProvider{
+		files: map[string][]byte{path: testPaletteData(256)},
+		loads: make(map[string]int),
+	}
+	first := GetPalette(d2enum.Units, fileProvider)
+	second := GetPalette(d2enum.Units, fileProvider)
+	if first != second || first.Colors[1] != (PaletteRGB{R: 5, G: 4, B: 3}) || fileProvider.loads[path] != 1 {
+		t.Fatalf("Expected the palette to be loaded once, got %d loads", fileProvider.loads[path])
+	}
+	ClearPaletteCache()
+	GetPalette(d2enum.Units, fileProvider)
+	if fileProvider.loads[path] != 2 {
+		t.Fatalf("Expected the palette to be loaded again after clearing the cache, got %d loads", fileProvider.loads[path])
+	}
+}
+
+func TestLoadPaletteFromMPQ(t *testing.T) {
+	directory, err := ioutil.TempDir("", "d2datadict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	writer := d2mpq.NewWriter()
+	writer.AddFile(palettePath(d2enum.Act1), testPaletteData(256))
+	writer.AddFile(palettePath(d2enum.Units), testPaletteData(255))
+	fileName := filepath.Join(directory, "test.mpq")
+	if err = writer.WriteFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	mpq, err := d2mpq.LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	palette, err := LoadPaletteFromMPQ(mpq, d2enum.Act1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if palette.Colors[1] != (PaletteRGB{R: 5, G: 4, B: 3}) {
+		t.Fatalf("Expected the palette from the archive, got %v", palette.Colors[1])
+	}
+	if _, err = LoadPaletteFromMPQ(mpq, d2enum.Units); err == nil {
+		t.Fatal("Expected an error for a palette of 255 colors")
+	}
+	if _, err = LoadPaletteFromMPQ(mpq, d2enum.Sky); err == nil {
+		t.Fatal("Expected an error for a palette missing from the archive")
+	}
+}
@@ -0,0 +1,332 @@
+package d2dc6
+
+import (
+	"fmt"
+	"image"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenDiablo2/D2Shared/d2common"
+	"github.com/OpenDiablo2/D2Shared/d2common/d2interface"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+// Sanity bounds for the values read from DC6 headers, so corrupt files are rejected rather than misparsed
+const (
+	maxDirections         = 32
+	maxFramesPerDirection = 1024
+	maxFrameSize          = 4096
+)
+
+// Header values of the DC6 files the parser understands
+const (
+	dc6Version  = 6
+	dc6Encoding = 0
+)
+
+// DC6File represents a DC6 sprite file
+type DC6File struct {
+	Version            int32
+	Flags              uint32
+	Encoding           uint32
+	Termination        [4]byte
+	Directions         uint32
+	FramesPerDirection uint32
+	FramePointers      []uint32
+	Frames             []*DC6Frame
+	stats              *decodeCounters
+}
+
+// FrameHeader holds the layout values of a frame, without its pixel data
+type FrameHeader struct {
+	Width   int
+	Height  int
+	OffsetX int
+	OffsetY int
+	Flipped bool
+}
+
+// LoadDC6 loads a DC6 file and binds the palette to all of its frames
+func LoadDC6(path string, fileProvider d2interface.FileProvider, palette d2datadict.PaletteRec) (DC6File, error) {
+	result, err := LoadDC6Raw(fileProvider.LoadFile(path))
+	if err != nil {
+		return DC6File{}, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, frame := range result.Frames {
+		frame.palette = palette
+	}
+	return result, nil
+}
+
+// LoadOptions configures how DC6 files are parsed
+type LoadOptions struct {
+	// ChainBlocks follows the NextBlock field of frames whose data is split across several blocks. A NextBlock of 0,
+	// past the end of the file, at the header of a frame or at a block already read ends the frame. Any other offset is
+	// read as a continuation block, which has the layout of a frame header followed by its data, and its data is
+	// appended to the frame. The Length of the frame is then the length of all of its data.
+	ChainBlocks bool
+}
+
+// LoadDC6Raw parses a DC6 file without binding a palette to its frames. Render the frames with RGBAWithPalette, or
+// any of the other functions that take a palette.
+func LoadDC6Raw(data []byte) (DC6File, error) {
+	return LoadDC6RawWithOptions(data, LoadOptions{})
+}
+
+// LoadDC6RawWithOptions parses a DC6 file using the given options, without binding a palette to its frames
+func LoadDC6RawWithOptions(data []byte, options LoadOptions) (DC6File, error) {
+	result := DC6File{stats: &decodeCounters{}}
+	if len(data) < 24 {
+		return result, fmt.Errorf("dc6 data is too short (%d bytes)", len(data))
+	}
+	br := d2common.CreateStreamReader(data)
+	result.Version = br.GetInt32()
+	result.Flags = br.GetUInt32()
+	result.Encoding = br.GetUInt32()
+	for i := range result.Termination {
+		result.Termination[i] = br.GetByte()
+	}
+	if result.Version != dc6Version {
+		return result, fmt.Errorf("dc6 version %d is not supported, expected version %d", result.Version, dc6Version)
+	}
+	if result.Flags > 1 {
+		return result, fmt.Errorf("dc6 flags %#x are not supported, expected 0 or 1", result.Flags)
+	}
+	if result.Encoding != dc6Encoding {
+		return result, fmt.Errorf("dc6 encoding %d is not supported, expected encoding %d", result.Encoding, dc6Encoding)
+	}
+	result.Directions = br.GetUInt32()
+	result.FramesPerDirection = br.GetUInt32()
+	if result.Directions == 0 || result.Directions > maxDirections {
+		return result, fmt.Errorf("dc6 has %d directions, expected 1 to %d", result.Directions, maxDirections)
+	}
+	if result.FramesPerDirection == 0 || result.FramesPerDirection > maxFramesPerDirection {
+		return result, fmt.Errorf("dc6 has %d frames per direction, expected 1 to %d",
+			result.FramesPerDirection, maxFramesPerDirection)
+	}
+	frameCount := uint64(result.Directions) * uint64(result.FramesPerDirection)
+	framePointerTableEnd := br.GetPosition() + (frameCount * 4)
+	if framePointerTableEnd > br.GetSize() {
+		return result, fmt.Errorf("dc6 frame pointer table is truncated, %d directions of %d frames need %d bytes "+
+			"but only %d remain", result.Directions, result.FramesPerDirection, frameCount*4,
+			br.GetSize()-br.GetPosition())
+	}
+	result.FramePointers = make([]uint32, frameCount)
+	for i := range result.FramePointers {
+		result.FramePointers[i] = br.GetUInt32()
+	}
+	result.Frames = make([]*DC6Frame, frameCount)
+	for i, framePointer := range result.FramePointers {
+		if uint64(framePointer) < framePointerTableEnd || uint64(framePointer)+32 > br.GetSize() {
+			return result, fmt.Errorf("dc6 frame %d pointer %d is outside of the frame data (%d to %d)",
+				i, framePointer, framePointerTableEnd, br.GetSize())
+		}
+		br.SetPosition(uint64(framePointer))
+		frame := &DC6Frame{rgbaCacheLimit: DefaultRGBACacheLimit, stats: result.stats}
+		frame.Flipped = br.GetUInt32()
+		frame.Width = br.GetUInt32()
+		frame.Height = br.GetUInt32()
+		frame.OffsetX = br.GetInt32()
+		frame.OffsetY = br.GetInt32()
+		frame.Unknown = br.GetUInt32()
+		frame.NextBlock = br.GetUInt32()
+		frame.Length = br.GetUInt32()
+		if frame.Width > maxFrameSize || frame.Height > maxFrameSize {
+			return result, fmt.Errorf("dc6 frame %d is %dx%d, expected at most %dx%d",
+				i, frame.Width, frame.Height, maxFrameSize, maxFrameSize)
+		}
+		if br.GetPosition()+uint64(frame.Length) > br.GetSize() {
+			return result, fmt.Errorf("dc6 frame %d data is truncated", i)
+		}
+		frame.FrameData, _ = br.ReadBytes(int(frame.Length))
+		if br.GetPosition()+3 <= br.GetSize() {
+			frame.Terminator, _ = br.ReadBytes(3)
+		}
+		if options.ChainBlocks {
+			if err := readChainedBlocks(br, frame, result.FramePointers, framePointerTableEnd); err != nil {
+				return result, fmt.Errorf("dc6 frame %d: %v", i, err)
+			}
+		}
+		result.Frames[i] = frame
+	}
+	return result, nil
+}
+
+// readChainedBlocks appends the data of the continuation blocks that NextBlock chains to the frame
+func readChainedBlocks(br *d2common.StreamReader, frame *DC6Frame, framePointers []uint32,
+	framePointerTableEnd uint64) error {
+	visited := make(map[uint32]bool)
+	for _, framePointer := range framePointers {
+		visited[framePointer] = true
+	}
+	for next := frame.NextBlock; next != 0 && uint64(next) < br.GetSize() && !visited[next]; {
+		visited[next] = true
+		if uint64(next) < framePointerTableEnd || uint64(next)+32 > br.GetSize() {
+			return fmt.Errorf("block at %d is outside of the frame data (%d to %d)",
+				next, framePointerTableEnd, br.GetSize())
+		}
+		br.SetPosition(uint64(next) + 24)
+		next = br.GetUInt32()
+		length := br.GetUInt32()
+		if br.GetPosition()+uint64(length) > br.GetSize() {
+			return fmt.Errorf("block data is truncated")
+		}
+		data, _ := br.ReadBytes(int(length))
+		frame.FrameData = append(frame.FrameData, data...)
+	}
+	frame.Length = uint32(len(frame.FrameData))
+	return nil
+}
+
+// Frame returns the frame for the direction and frame index
+func (v *DC6File) Frame(direction, frame int) (*DC6Frame, error) {
+	if direction < 0 || direction >= int(v.Directions) || frame < 0 || frame >= int(v.FramesPerDirection) {
+		return nil, fmt.Errorf("dc6 frame %d of direction %d is out of range", frame, direction)
+	}
+	return v.Frames[(direction*int(v.FramesPerDirection))+frame], nil
+}
+
+// Validate checks the RLE data of every frame against its declared length, and returns an error for the first frame
+// that does not match
+func (v *DC6File) Validate() error {
+	for i, frame := range v.Frames {
+		if err := frame.Validate(); err != nil {
+			return fmt.Errorf("frame %d of direction %d: %v", i%int(v.FramesPerDirection), i/int(v.FramesPerDirection), err)
+		}
+	}
+	return nil
+}
+
+// DirectionCount returns the number of directions in the file
+func (v *DC6File) DirectionCount() int {
+	return int(v.Directions)
+}
+
+// FrameCount returns the number of frames in each direction
+func (v *DC6File) FrameCount() int {
+	return int(v.FramesPerDirection)
+}
+
+// EnableStats starts collecting the decode stats of the file. Until it is called, decoding does not time or count
+// anything, so Stats reports nothing.
+func (v *DC6File) EnableStats() {
+	if v.stats != nil {
+		atomic.StoreInt32(&v.stats.enabled, 1)
+	}
+}
+
+// Stats returns how many frames of the file were decoded since EnableStats was called, how much RLE data that
+// processed and how long it took. Images served from the RGBA cache are not decoded again, so they are not counted.
+func (v *DC6File) Stats() DecodeStats {
+	if v.stats == nil {
+		return DecodeStats{}
+	}
+	return DecodeStats{
+		FramesDecoded: atomic.LoadInt64(&v.stats.frames),
+		BytesDecoded:  atomic.LoadInt64(&v.stats.bytes),
+		DecodeTime:    time.Duration(atomic.LoadInt64(&v.stats.nanos)),
+	}
+}
+
+// SetRGBACacheLimit sets the number of rendered palettes each frame keeps. A limit of 0 disables the cache.
+func (v *DC6File) SetRGBACacheLimit(limit int) {
+	for _, frame := range v.Frames {
+		frame.SetRGBACacheLimit(limit)
+	}
+}
+
+// ClearRGBACache drops the rendered images cached on all frames
+func (v *DC6File) ClearRGBACache() {
+	for _, frame := range v.Frames {
+		frame.ClearRGBACache()
+	}
+}
+
+// FrameIndices decodes a frame into a flat buffer of palette indices, in rows from top to bottom. Pixels that are not
+// filled are set to -1.
+func (v *DC6File) FrameIndices(direction, frame int) (indices []int16, w, h int, err error) {
+	dc6Frame, err := v.Frame(direction, frame)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return dc6Frame.ImageData(), int(dc6Frame.Width), int(dc6Frame.Height), nil
+}
+
+// PaletteUsage returns how many pixels use each palette index, across all frames of the file
+func (v *DC6File) PaletteUsage() [256]int {
+	var result [256]int
+	for _, frame := range v.Frames {
+		for _, paletteIndex := range frame.ImageData() {
+			if paletteIndex >= 0 {
+				result[paletteIndex]++
+			}
+		}
+	}
+	return result
+}
+
+// FrameImage renders a frame with the palette, and returns it with the position of its top left corner relative to
+// the sprite origin
+func (v *DC6File) FrameImage(direction, frame int, palette d2datadict.PaletteRec) (*image.RGBA, image.Point, error) {
+	dc6Frame, err := v.Frame(direction, frame)
+	if err != nil {
+		return nil, image.Point{}, err
+	}
+	origin := image.Pt(int(dc6Frame.OffsetX), int(dc6Frame.OffsetY)-int(dc6Frame.Height))
+	return dc6Frame.RGBAWithPalette(palette), origin, nil
+}
+
+// FrameHeaders returns the headers of all frames, ordered by direction and then frame like Frames. No frame data is
+// decoded, so this is cheap enough to plan layouts for frames that may never be rendered.
+func (v *DC6File) FrameHeaders() []FrameHeader {
+	result := make([]FrameHeader, len(v.Frames))
+	for i, frame := range v.Frames {
+		result[i] = FrameHeader{
+			Width:   int(frame.Width),
+			Height:  int(frame.Height),
+			OffsetX: int(frame.OffsetX),
+			OffsetY: int(frame.OffsetY),
+			Flipped: frame.Flipped != 0,
+		}
+	}
+	return result
+}
+
+// DirectionBounds returns the union of the areas covered by the frames of the direction, relative to the sprite
+// origin. Reserving this area keeps the layout from shifting while the animation plays. Directions that are out of
+// range return an empty rectangle.
+func (v *DC6File) DirectionBounds(direction int) image.Rectangle {
+	var result image.Rectangle
+	if direction < 0 || direction >= int(v.Directions) {
+		return result
+	}
+	start := direction * int(v.FramesPerDirection)
+	for _, frame := range v.Frames[start : start+int(v.FramesPerDirection)] {
+		result = result.Union(frame.spriteBounds())
+	}
+	return result
+}
+
+// NormalizeOffsets moves every frame so that its center is at the anchor, relative to the sprite origin. Frames of
+// different sizes then stay centered on the same point, which keeps icons and portraits from jittering between
+// frames. Only the offsets used by FrameImage change, the pixel data is not touched.
+func (v *DC6File) NormalizeOffsets(anchorX, anchorY int) {
+	for _, frame := range v.Frames {
+		frame.OffsetX = int32(anchorX - (int(frame.Width) / 2))
+		// OffsetY is the bottom of the frame
+		frame.OffsetY = int32(anchorY - (int(frame.Height) / 2) + int(frame.Height))
+	}
+}
+
+// IsShadow guesses whether the file is a shadow or overlay sprite, which should be drawn as a flat blob rather than
+// with its palette colors. This is a best-effort heuristic: a sprite is considered a shadow when all of its filled
+// pixels use the same palette index.
+func (v *DC6File) IsShadow() bool {
+	usedIndices := 0
+	for _, count := range v.PaletteUsage() {
+		if count > 0 {
+			usedIndices++
+		}
+	}
+	return usedIndices == 1
+}
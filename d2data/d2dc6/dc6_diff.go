@@ -0,0 +1,65 @@
+package d2dc6
+
+import (
+	"fmt"
+	"image"
+)
+
+// FrameDiff describes the pixels that differ between the same frame of two DC6 files
+type FrameDiff struct {
+	Direction int
+	Frame     int
+	Changed   int             // Number of pixels whose palette index differs
+	Bounds    image.Rectangle // Bounding box of the changed pixels, relative to the sprite origin
+}
+
+// Diff compares the palette indices of every frame with the matching frame of the other file. Frames are compared
+// relative to the sprite origin, so a frame that was only moved shows up as changed. One entry is returned per frame,
+// in the same order as Frames. An error is returned if the files have a different number of directions or frames.
+func (v *DC6File) Diff(other *DC6File) ([]FrameDiff, error) {
+	if v.Directions != other.Directions || v.FramesPerDirection != other.FramesPerDirection {
+		return nil, fmt.Errorf("dc6 layouts differ, %d directions of %d frames versus %d directions of %d frames",
+			v.Directions, v.FramesPerDirection, other.Directions, other.FramesPerDirection)
+	}
+	result := make([]FrameDiff, len(v.Frames))
+	for i := range v.Frames {
+		result[i] = diffFrames(v.Frames[i], other.Frames[i])
+		result[i].Direction = i / int(v.FramesPerDirection)
+		result[i].Frame = i % int(v.FramesPerDirection)
+	}
+	return result, nil
+}
+
+// diffFrames compares two frames over the union of their areas
+func diffFrames(a, b *DC6Frame) FrameDiff {
+	result := FrameDiff{}
+	boundsA, boundsB := a.spriteBounds(), b.spriteBounds()
+	indicesA, indicesB := a.ImageData(), b.ImageData()
+	area := boundsA.Union(boundsB)
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			point := image.Pt(x, y)
+			if spriteIndexAt(indicesA, boundsA, point) == spriteIndexAt(indicesB, boundsB, point) {
+				continue
+			}
+			result.Changed++
+			result.Bounds = result.Bounds.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	return result
+}
+
+// spriteBounds returns the area covered by the frame, relative to the sprite origin
+func (v *DC6Frame) spriteBounds() image.Rectangle {
+	origin := image.Pt(int(v.OffsetX), int(v.OffsetY)-int(v.Height))
+	return image.Rect(0, 0, int(v.Width), int(v.Height)).Add(origin)
+}
+
+// spriteIndexAt returns the palette index at a point relative to the sprite origin, or -1 if it is not filled
+func spriteIndexAt(indices []int16, bounds image.Rectangle, point image.Point) int16 {
+	if !point.In(bounds) {
+		return -1
+	}
+	x, y := point.X-bounds.Min.X, point.Y-bounds.Min.Y
+	return indices[(y*bounds.Dx())+x]
+}
@@ -0,0 +1,370 @@
+package d2dc6
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+// DefaultRGBACacheLimit is the number of rendered palettes a loaded frame keeps by default
+const DefaultRGBACacheLimit = 4
+
+// paletteKey identifies a palette by its colors
+type paletteKey [256]d2datadict.PaletteRGB
+
+// DC6Frame represents a single frame in a DC6 file
+type DC6Frame struct {
+	Flipped    uint32
+	Width      uint32
+	Height     uint32
+	OffsetX    int32
+	OffsetY    int32
+	Unknown    uint32
+	NextBlock  uint32 // Offset of the block after this frame, usually the next frame header. See LoadOptions.ChainBlocks.
+	Length     uint32
+	FrameData  []byte // size is the value of Length
+	Terminator []byte // 3 bytes
+	palette    d2datadict.PaletteRec
+
+	cacheMutex     sync.Mutex
+	rgbaCache      map[paletteKey]*image.RGBA
+	rgbaCacheOrder []paletteKey
+	rgbaCacheLimit int
+	indices        []int16 // Decoded image data, filled on the first call to decodedIndices
+	stats          *decodeCounters
+}
+
+// DecodeStats describes the frame decoding done for a DC6 file
+type DecodeStats struct {
+	FramesDecoded int64         // Number of times a frame was decoded
+	BytesDecoded  int64         // Bytes of RLE data processed
+	DecodeTime    time.Duration // Time spent decoding
+}
+
+// decodeCounters collects the decode stats shared by all frames of a file. Nothing is collected until enabled is set.
+type decodeCounters struct {
+	enabled int32
+	frames  int64
+	bytes   int64
+	nanos   int64
+}
+
+// active returns true if the decode stats are being collected
+func (v *decodeCounters) active() bool {
+	return v != nil && atomic.LoadInt32(&v.enabled) != 0
+}
+
+func (v *decodeCounters) record(bytes int, start time.Time) {
+	atomic.AddInt64(&v.frames, 1)
+	atomic.AddInt64(&v.bytes, int64(bytes))
+	atomic.AddInt64(&v.nanos, int64(time.Since(start)))
+}
+
+// ImageData decodes the RLE frame data into palette indices. Pixels that are not filled are set to -1.
+func (v *DC6Frame) ImageData() []int16 {
+	return v.decodeInto(make([]int16, int(v.Width)*int(v.Height)))
+}
+
+// imageDataPool holds the buffers frames are decoded into while rendering, so rendering does not allocate them
+var imageDataPool = sync.Pool{
+	New: func() interface{} {
+		return new([]int16)
+	},
+}
+
+// pooledImageData decodes the frame into a buffer from imageDataPool, which the caller must put back once it is done
+// with the indices. The buffer is grown when a larger frame uses it, and only the part the size of this frame is used.
+func (v *DC6Frame) pooledImageData() (*[]int16, []int16) {
+	buffer := imageDataPool.Get().(*[]int16)
+	size := int(v.Width) * int(v.Height)
+	if cap(*buffer) < size {
+		*buffer = make([]int16, size)
+	}
+	return buffer, v.decodeInto((*buffer)[:size])
+}
+
+// decodeInto decodes the frame into imageData, which must hold Width*Height indices
+func (v *DC6Frame) decodeInto(imageData []int16) []int16 {
+	v.decode(imageData)
+	return imageData
+}
+
+// decode decodes the frame into imageData, which must hold Width*Height indices. It returns the number of bytes of RLE
+// data used, and whether the data ended with the end marker of the last row.
+func (v *DC6Frame) decode(imageData []int16) (consumed int, complete bool) {
+	if v.stats.active() {
+		defer v.stats.record(len(v.FrameData), time.Now())
+	}
+	width := int(v.Width)
+	height := int(v.Height)
+	for i := range imageData {
+		imageData[i] = -1
+	}
+	x := 0
+	y := height - 1
+	dataPointer := 0
+	complete = height == 0
+	for dataPointer < len(v.FrameData) {
+		b := v.FrameData[dataPointer]
+		dataPointer++
+		if b == 0x80 {
+			if y == 0 {
+				complete = true
+				break
+			}
+			y--
+			x = 0
+		} else if (b & 0x80) > 0 {
+			x += int(b & 0x7F)
+		} else {
+			if dataPointer+int(b) > len(v.FrameData) {
+				// The run is cut off, so the end marker of the last row can not follow
+				complete = false
+			}
+			for i := 0; i < int(b) && dataPointer < len(v.FrameData); i++ {
+				if x < width && y >= 0 {
+					imageData[x+(y*width)] = int16(v.FrameData[dataPointer])
+				}
+				dataPointer++
+				x++
+			}
+		}
+	}
+	return dataPointer, complete
+}
+
+// Validate decodes the frame and checks that its RLE data ends with the end marker of the last row, exactly at the
+// declared Length. Frames that fail still decode, but are likely truncated or padded.
+func (v *DC6Frame) Validate() error {
+	consumed, complete := v.decode(make([]int16, int(v.Width)*int(v.Height)))
+	if !complete {
+		return fmt.Errorf("dc6 frame data is truncated, its %d bytes end before the last row", len(v.FrameData))
+	}
+	if consumed != int(v.Length) {
+		return fmt.Errorf("dc6 frame data ends after %d bytes, but its declared length is %d", consumed, v.Length)
+	}
+	return nil
+}
+
+// RGBA renders the frame using the palette bound at load time
+func (v *DC6Frame) RGBA() *image.RGBA {
+	return v.RGBAWithPalette(v.palette)
+}
+
+// RGBAWithPalette renders the frame using the given palette. Rendered images are cached per palette, so the returned
+// image is shared and must not be modified.
+func (v *DC6Frame) RGBAWithPalette(palette d2datadict.PaletteRec) *image.RGBA {
+	key := paletteKey(palette.Colors)
+	v.cacheMutex.Lock()
+	defer v.cacheMutex.Unlock()
+	if cached, ok := v.rgbaCache[key]; ok {
+		return cached
+	}
+	result := v.renderImage(palette)
+	v.cacheImage(key, result)
+	return result
+}
+
+// RenderInto renders the frame with the palette bound at load time into dst, with its top left corner at (x, y). The
+// whole frame area is replaced, including the pixels that are not filled. This allows many frames to be packed into a
+// single preallocated sprite sheet without allocating an image per frame. Frames are decoded straight into the pixels
+// of an *image.RGBA, so rendering into one does not allocate.
+func (v *DC6Frame) RenderInto(dst draw.Image, x, y int) error {
+	area := v.Bounds().Add(image.Pt(x, y))
+	if !area.In(dst.Bounds()) {
+		return fmt.Errorf("dc6 frame area %v does not fit into the destination bounds %v", area, dst.Bounds())
+	}
+	buffer, imageData := v.pooledImageData()
+	defer imageDataPool.Put(buffer)
+	if rgba, ok := dst.(*image.RGBA); ok {
+		width := int(v.Width)
+		for i, paletteIndex := range imageData {
+			offset := rgba.PixOffset(area.Min.X+(i%width), area.Min.Y+(i/width))
+			pixel := rgba.Pix[offset : offset+4 : offset+4]
+			if paletteIndex < 0 {
+				pixel[0], pixel[1], pixel[2], pixel[3] = 0, 0, 0, 0
+				continue
+			}
+			paletteColor := v.palette.Colors[paletteIndex]
+			pixel[0], pixel[1], pixel[2], pixel[3] = paletteColor.R, paletteColor.G, paletteColor.B, 0xFF
+		}
+		return nil
+	}
+	for i, paletteIndex := range imageData {
+		pixel := color.RGBA{}
+		if paletteIndex >= 0 {
+			paletteColor := v.palette.Colors[paletteIndex]
+			pixel = color.RGBA{R: paletteColor.R, G: paletteColor.G, B: paletteColor.B, A: 0xFF}
+		}
+		dst.Set(area.Min.X+(i%int(v.Width)), area.Min.Y+(i/int(v.Width)), pixel)
+	}
+	return nil
+}
+
+// RGBAWithRemap renders the frame using the given palette, after mapping every palette index through the remap table.
+// This is how light radius and special states recolor sprites without building a new palette. The result is not
+// cached.
+func (v *DC6Frame) RGBAWithRemap(palette d2datadict.PaletteRec, remap [256]byte) *image.RGBA {
+	result := image.NewRGBA(v.Bounds())
+	for i, paletteIndex := range v.decodedIndices() {
+		if paletteIndex < 0 {
+			continue
+		}
+		paletteColor := palette.Colors[remap[paletteIndex]]
+		result.Pix[i*4] = paletteColor.R
+		result.Pix[(i*4)+1] = paletteColor.G
+		result.Pix[(i*4)+2] = paletteColor.B
+		result.Pix[(i*4)+3] = 0xFF
+	}
+	return result
+}
+
+// decodedIndices returns the decoded image data, decoding it on the first call. The result is shared and must not be
+// modified.
+func (v *DC6Frame) decodedIndices() []int16 {
+	v.cacheMutex.Lock()
+	defer v.cacheMutex.Unlock()
+	if v.indices == nil {
+		v.indices = v.ImageData()
+	}
+	return v.indices
+}
+
+// SetRGBACacheLimit sets the number of rendered palettes the frame keeps. A limit of 0 disables the cache.
+func (v *DC6Frame) SetRGBACacheLimit(limit int) {
+	v.cacheMutex.Lock()
+	defer v.cacheMutex.Unlock()
+	v.rgbaCacheLimit = limit
+	for len(v.rgbaCacheOrder) > limit {
+		v.evictOldest()
+	}
+}
+
+// ClearRGBACache drops all cached rendered images
+func (v *DC6Frame) ClearRGBACache() {
+	v.cacheMutex.Lock()
+	defer v.cacheMutex.Unlock()
+	v.rgbaCache = nil
+	v.rgbaCacheOrder = nil
+}
+
+func (v *DC6Frame) cacheImage(key paletteKey, img *image.RGBA) {
+	if v.rgbaCacheLimit <= 0 {
+		return
+	}
+	if v.rgbaCache == nil {
+		v.rgbaCache = make(map[paletteKey]*image.RGBA)
+	}
+	for len(v.rgbaCacheOrder) >= v.rgbaCacheLimit {
+		v.evictOldest()
+	}
+	v.rgbaCache[key] = img
+	v.rgbaCacheOrder = append(v.rgbaCacheOrder, key)
+}
+
+func (v *DC6Frame) evictOldest() {
+	delete(v.rgbaCache, v.rgbaCacheOrder[0])
+	v.rgbaCacheOrder = v.rgbaCacheOrder[1:]
+}
+
+func (v *DC6Frame) renderImage(palette d2datadict.PaletteRec) *image.RGBA {
+	// The decoded indices are only needed while rendering, so they are decoded into a pooled buffer
+	buffer, imageData := v.pooledImageData()
+	defer imageDataPool.Put(buffer)
+	result := image.NewRGBA(image.Rect(0, 0, int(v.Width), int(v.Height)))
+	for i, paletteIndex := range imageData {
+		if paletteIndex < 0 {
+			continue
+		}
+		paletteColor := palette.Colors[paletteIndex]
+		result.Pix[i*4] = paletteColor.R
+		result.Pix[(i*4)+1] = paletteColor.G
+		result.Pix[(i*4)+2] = paletteColor.B
+		result.Pix[(i*4)+3] = 0xFF
+	}
+	return result
+}
+
+// AlphaMask returns the coverage of the frame, independent of any palette. Filled pixels are opaque and pixels that are
+// not filled are transparent.
+func (v *DC6Frame) AlphaMask() *image.Alpha {
+	result := image.NewAlpha(v.Bounds())
+	for i, paletteIndex := range v.ImageData() {
+		if paletteIndex >= 0 {
+			result.Pix[i] = 0xFF
+		}
+	}
+	return result
+}
+
+// asciiRamp holds the characters ASCIIArt uses, from no coverage to full coverage
+const asciiRamp = " .:*#"
+
+// ASCIIArt returns a text preview of the shape of the frame, cols characters wide with one line per row. Each character
+// shows how much of the area it covers is filled. Rows cover twice the height of columns, since characters are about
+// twice as tall as they are wide.
+func (v *DC6Frame) ASCIIArt(cols int) string {
+	width, height := int(v.Width), int(v.Height)
+	if cols <= 0 || width == 0 || height == 0 {
+		return ""
+	}
+	if cols > width {
+		cols = width
+	}
+	rows := (height*cols + width) / (2 * width)
+	if rows == 0 {
+		rows = 1
+	}
+	mask := v.AlphaMask()
+	var result strings.Builder
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			area := image.Rect(col*width/cols, row*height/rows, (col+1)*width/cols, (row+1)*height/rows)
+			filled := 0
+			for y := area.Min.Y; y < area.Max.Y; y++ {
+				for x := area.Min.X; x < area.Max.X; x++ {
+					if mask.AlphaAt(x, y).A != 0 {
+						filled++
+					}
+				}
+			}
+			level := (filled * (len(asciiRamp) - 1)) / (area.Dx() * area.Dy())
+			if filled > 0 && level == 0 {
+				level = 1
+			}
+			result.WriteByte(asciiRamp[level])
+		}
+		result.WriteByte('\n')
+	}
+	return result.String()
+}
+
+// ColorModel returns the color model of the frame, so it can be used as an image.Image
+func (v *DC6Frame) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+// Bounds returns the size of the frame, with its top left corner at (0, 0)
+func (v *DC6Frame) Bounds() image.Rectangle {
+	return image.Rect(0, 0, int(v.Width), int(v.Height))
+}
+
+// At returns the color of a pixel using the palette bound at load time. Pixels that are not filled are transparent.
+func (v *DC6Frame) At(x, y int) color.Color {
+	if !image.Pt(x, y).In(v.Bounds()) {
+		return color.RGBA{}
+	}
+	paletteIndex := v.decodedIndices()[(y*int(v.Width))+x]
+	if paletteIndex < 0 {
+		return color.RGBA{}
+	}
+	paletteColor := v.palette.Colors[paletteIndex]
+	return color.RGBA{R: paletteColor.R, G: paletteColor.G, B: paletteColor.B, A: 0xFF}
+}
@@ -0,0 +1,52 @@
+package d2dc6
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+)
+
+// EncodeDirectionGIF writes the frames of the direction as a looping animated GIF, showing each frame for delayCentis
+// hundredths of a second. The palette bound at load time is the color table, with index 0 as the transparent color.
+// The canvas covers DirectionBounds, and each frame is placed on it by its offsets.
+func (v *DC6File) EncodeDirectionGIF(direction int, w io.Writer, delayCentis int) error {
+	if direction < 0 || direction >= int(v.Directions) {
+		return fmt.Errorf("dc6 direction %d is out of range", direction)
+	}
+	canvas := v.DirectionBounds(direction)
+	if canvas.Empty() {
+		return fmt.Errorf("dc6 direction %d has no pixels to encode", direction)
+	}
+	if delayCentis < 0 {
+		delayCentis = 0
+	}
+	frameCount := int(v.FramesPerDirection)
+	frames := v.Frames[direction*frameCount : (direction+1)*frameCount]
+	palette := make(color.Palette, len(frames[0].palette.Colors))
+	for i, paletteColor := range frames[0].palette.Colors {
+		palette[i] = color.RGBA{R: paletteColor.R, G: paletteColor.G, B: paletteColor.B, A: 0xFF}
+	}
+	palette[0] = color.RGBA{}
+	animation := &gif.GIF{
+		Config: image.Config{ColorModel: palette, Width: canvas.Dx(), Height: canvas.Dy()},
+	}
+	for _, frame := range frames {
+		area := frame.spriteBounds().Sub(canvas.Min)
+		if area.Empty() {
+			// GIF frames must cover at least one pixel
+			area = image.Rect(0, 0, 1, 1)
+		}
+		img := image.NewPaletted(area, palette)
+		for i, paletteIndex := range frame.ImageData() {
+			if paletteIndex > 0 {
+				img.Pix[i] = uint8(paletteIndex)
+			}
+		}
+		animation.Image = append(animation.Image, img)
+		animation.Delay = append(animation.Delay, delayCentis)
+		animation.Disposal = append(animation.Disposal, gif.DisposalBackground)
+	}
+	return gif.EncodeAll(w, animation)
+}
@@ -0,0 +1,58 @@
+package d2dc6
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// OnionSkin composites the frames from centerFrame-span to centerFrame+span of the direction, using the palette bound
+// at load time. The center frame is opaque and the other frames fade out with their distance from it, with frames
+// closer to the center drawn on top. Frames are placed by their offsets, so the bounds of the returned image are
+// relative to the sprite origin. Frame numbers out of range are clamped to the frames of the direction.
+func (v *DC6File) OnionSkin(direction, centerFrame, span int) (*image.RGBA, error) {
+	frameCount := int(v.FramesPerDirection)
+	if direction < 0 || direction >= int(v.Directions) || frameCount == 0 {
+		return nil, fmt.Errorf("dc6 direction %d is out of range", direction)
+	}
+	if span < 0 {
+		span = 0
+	}
+	centerFrame = clampFrame(centerFrame, frameCount)
+	first := clampFrame(centerFrame-span, frameCount)
+	last := clampFrame(centerFrame+span, frameCount)
+	frames := v.Frames[direction*frameCount : (direction+1)*frameCount]
+
+	var bounds image.Rectangle
+	for _, frame := range frames[first : last+1] {
+		bounds = bounds.Union(frame.spriteBounds())
+	}
+	result := image.NewRGBA(bounds)
+	for distance := span; distance >= 0; distance-- {
+		alpha := color.Alpha{A: uint8((0xFF * (span + 1 - distance)) / (span + 1))}
+		for _, frameIndex := range []int{centerFrame - distance, centerFrame + distance} {
+			if frameIndex < first || frameIndex > last {
+				continue
+			}
+			frame := frames[frameIndex]
+			draw.DrawMask(result, frame.spriteBounds(), frame.RGBA(), image.Point{}, image.NewUniform(alpha),
+				image.Point{}, draw.Over)
+			if distance == 0 {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// clampFrame limits a frame number to the frames of a direction
+func clampFrame(frame, frameCount int) int {
+	if frame < 0 {
+		return 0
+	}
+	if frame >= frameCount {
+		return frameCount - 1
+	}
+	return frame
+}
@@ -0,0 +1,78 @@
+package d2dc6
+
+import (
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+)
+
+// SheetFrame describes where a frame is placed in a sprite sheet written by ExportSheet. Its JSON field names are part
+// of the sheet format and do not change.
+type SheetFrame struct {
+	Direction int `json:"dir"`
+	Frame     int `json:"frame"`
+	X         int `json:"x"` // Left edge of the frame in the sheet
+	Y         int `json:"y"` // Top edge of the frame in the sheet
+	Width     int `json:"w"`
+	Height    int `json:"h"`
+	OffsetX   int `json:"offsetX"` // Offset of the left edge of the frame from the sprite origin
+	OffsetY   int `json:"offsetY"` // Offset of the bottom edge of the frame from the sprite origin
+}
+
+// SheetMeta is the JSON document written by ExportSheet
+type SheetMeta struct {
+	Width  int          `json:"width"`  // Width of the sheet image
+	Height int          `json:"height"` // Height of the sheet image
+	Frames []SheetFrame `json:"frames"` // Ordered by direction and then frame, like Frames
+}
+
+// ExportSheet renders all frames with the palette bound at load time into a PNG sprite sheet written to w, and writes
+// a JSON SheetMeta describing the placement of every frame to meta. Frames are laid out in order into a grid of the
+// given number of columns, with cells the size of the largest frame.
+func (v *DC6File) ExportSheet(w io.Writer, meta io.Writer, columns int) error {
+	if columns <= 0 {
+		return errors.New("sprite sheet needs at least one column")
+	}
+	cellWidth, cellHeight := 0, 0
+	for _, frame := range v.Frames {
+		if int(frame.Width) > cellWidth {
+			cellWidth = int(frame.Width)
+		}
+		if int(frame.Height) > cellHeight {
+			cellHeight = int(frame.Height)
+		}
+	}
+	rows := (len(v.Frames) + columns - 1) / columns
+	if len(v.Frames) < columns {
+		columns = len(v.Frames)
+	}
+	sheet := image.NewRGBA(image.Rect(0, 0, columns*cellWidth, rows*cellHeight))
+	sheetMeta := SheetMeta{
+		Width:  sheet.Rect.Dx(),
+		Height: sheet.Rect.Dy(),
+		Frames: make([]SheetFrame, len(v.Frames)),
+	}
+	for i, frame := range v.Frames {
+		x := (i % columns) * cellWidth
+		y := (i / columns) * cellHeight
+		if err := frame.RenderInto(sheet, x, y); err != nil {
+			return err
+		}
+		sheetMeta.Frames[i] = SheetFrame{
+			Direction: i / int(v.FramesPerDirection),
+			Frame:     i % int(v.FramesPerDirection),
+			X:         x,
+			Y:         y,
+			Width:     int(frame.Width),
+			Height:    int(frame.Height),
+			OffsetX:   int(frame.OffsetX),
+			OffsetY:   int(frame.OffsetY),
+		}
+	}
+	if err := png.Encode(w, sheet); err != nil {
+		return err
+	}
+	return json.NewEncoder(meta).Encode(sheetMeta)
+}
@@ -0,0 +1,578 @@
+package d2dc6
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/OpenDiablo2/D2Shared/d2common"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+// testFrame describes a frame to encode into a test DC6 file
+type testFrame struct {
+	width, height    uint32
+	offsetX, offsetY int32
+	data             []byte
+}
+
+// encodeTestDC6 builds a DC6 file from the given frames, which are laid out direction by direction
+func encodeTestDC6(directions, framesPerDirection uint32, frames []testFrame) []byte {
+	sw := d2common.CreateStreamWriter()
+	sw.PushUint32(6)
+	sw.PushUint32(1)
+	sw.PushUint32(0)
+	sw.PushUint32(0xEEEEEEEE)
+	sw.PushUint32(directions)
+	sw.PushUint32(framesPerDirection)
+	framePointer := uint32(24 + (len(frames) * 4))
+	for _, frame := range frames {
+		sw.PushUint32(framePointer)
+		framePointer += 32 + uint32(len(frame.data)) + 3
+	}
+	for _, frame := range frames {
+		sw.PushUint32(0)
+		sw.PushUint32(frame.width)
+		sw.PushUint32(frame.height)
+		sw.PushUint32(uint32(frame.offsetX))
+		sw.PushUint32(uint32(frame.offsetY))
+		sw.PushUint32(0)
+		sw.PushUint32(0)
+		sw.PushUint32(uint32(len(frame.data)))
+		for _, b := range frame.data {
+			sw.PushByte(b)
+		}
+		sw.PushByte(0xEE)
+		sw.PushByte(0xEE)
+		sw.PushByte(0xEE)
+	}
+	return sw.GetBytes()
+}
+
+// testSprite is a 3x2 frame; the bottom row is "1 1 1" and the top row is "transparent 2 transparent"
+var testSprite = testFrame{width: 3, height: 2, offsetX: -1, offsetY: 2, data: []byte{3, 1, 1, 1, 0x80, 0x81, 1, 2, 0x80}}
+
+func testPalette(seed uint8) d2datadict.PaletteRec {
+	palette := d2datadict.PaletteRec{}
+	for i := range palette.Colors {
+		palette.Colors[i] = d2datadict.PaletteRGB{R: uint8(i) + seed, G: uint8(i), B: seed}
+	}
+	return palette
+}
+
+func TestImageData(t *testing.T) {
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int16{-1, 2, -1, 1, 1, 1}
+	imageData := dc6.Frames[0].ImageData()
+	for i := range expected {
+		if imageData[i] != expected[i] {
+			t.Fatalf("Expected image data %v but got %v instead", expected, imageData)
+		}
+	}
+}
+
+func TestAlphaMask(t *testing.T) {
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint8{0, 0xFF, 0, 0xFF, 0xFF, 0xFF}
+	mask := dc6.Frames[0].AlphaMask()
+	for i := range expected {
+		if mask.Pix[i] != expected[i] {
+			t.Fatalf("Expected mask %v but got %v instead", expected, mask.Pix)
+		}
+	}
+}
+
+func TestRGBACache(t *testing.T) {
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := dc6.Frames[0]
+	day := frame.RGBAWithPalette(testPalette(10))
+	if frame.RGBAWithPalette(testPalette(10)) != day {
+		t.Fatal("Expected the image rendered with a seen palette to be cached")
+	}
+	night := frame.RGBAWithPalette(testPalette(20))
+	if night == day || night.Pix[(1*4)] != 22 {
+		t.Fatal("Expected a different palette to render a new image")
+	}
+	dc6.SetRGBACacheLimit(1)
+	if frame.RGBAWithPalette(testPalette(10)) == day {
+		t.Fatal("Expected the oldest image to be evicted when the cache limit shrinks")
+	}
+	dc6.ClearRGBACache()
+	if len(frame.rgbaCache) != 0 {
+		t.Fatal("Expected the cache to be empty after clearing it")
+	}
+}
+
+func TestLoadEightDirections(t *testing.T) {
+	frames := make([]testFrame, 16)
+	for i := range frames {
+		frames[i] = testFrame{width: 1, height: 1, offsetX: int32(i), data: []byte{1, byte(i), 0x80}}
+	}
+	dc6, err := LoadDC6Raw(encodeTestDC6(8, 2, frames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dc6.Directions != 8 || dc6.FramesPerDirection != 2 || len(dc6.Frames) != 16 {
+		t.Fatalf("Expected 8 directions of 2 frames, got %d directions of %d frames (%d total)",
+			dc6.Directions, dc6.FramesPerDirection, len(dc6.Frames))
+	}
+	frame, err := dc6.Frame(5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.OffsetX != 11 || frame.ImageData()[0] != 11 {
+		t.Fatalf("Expected frame 1 of direction 5 to be the 12th frame, got offset %d", frame.OffsetX)
+	}
+}
+
+// encodeChainedDC6 builds a DC6 file with one frame, the 3x2 test sprite, whose rows are split across two blocks. The
+// frame header chains to a continuation block holding the top row.
+func encodeChainedDC6() []byte {
+	const (
+		framePointer = 28
+		blockPointer = framePointer + 32 + 5 + 3
+		fileEnd      = blockPointer + 32 + 4 + 3
+	)
+	sw := d2common.CreateStreamWriter()
+	for _, value := range []uint32{6, 1, 0, 0xEEEEEEEE, 1, 1, framePointer} {
+		sw.PushUint32(value)
+	}
+	blocks := []struct {
+		next uint32
+		data []byte
+	}{
+		{blockPointer, []byte{3, 1, 1, 1, 0x80}},
+		{fileEnd, []byte{0x81, 1, 2, 0x80}},
+	}
+	for _, block := range blocks {
+		for _, value := range []uint32{0, 3, 2, uint32(0xFFFFFFFF), 2, 0, block.next, uint32(len(block.data))} {
+			sw.PushUint32(value)
+		}
+		for _, b := range append(block.data, 0xEE, 0xEE, 0xEE) {
+			sw.PushByte(b)
+		}
+	}
+	return sw.GetBytes()
+}
+
+func TestChainedBlocks(t *testing.T) {
+	data := encodeChainedDC6()
+	chained, err := LoadDC6RawWithOptions(data, LoadOptions{ChainBlocks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unchained, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := chained.Frames[0]
+	if !bytes.Equal(frame.FrameData, testSprite.data) || frame.Length != uint32(len(testSprite.data)) {
+		t.Fatalf("Expected the data of both blocks, got %v", frame.FrameData)
+	}
+	if err := frame.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	palette := testPalette(0)
+	if !bytes.Equal(frame.RGBAWithPalette(palette).Pix, unchained.Frames[0].RGBAWithPalette(palette).Pix) {
+		t.Fatal("Expected the chained frame to render like the same frame in one block")
+	}
+
+	split, err := LoadDC6Raw(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(split.Frames[0].FrameData) != 5 || split.Frames[0].Validate() == nil {
+		t.Fatal("Expected only the first block to be read without ChainBlocks")
+	}
+	// A continuation block that does not fit in the file is an error
+	if _, err := LoadDC6RawWithOptions(data[:len(data)-10], LoadOptions{ChainBlocks: true}); err == nil {
+		t.Fatal("Expected an error for a truncated continuation block")
+	}
+}
+
+func TestLoadInvalidHeader(t *testing.T) {
+	data := encodeTestDC6(1, 1, []testFrame{testSprite})
+	data[20] = 200
+	if _, err := LoadDC6Raw(data); err == nil {
+		t.Fatal("Expected an error for a frame count that does not match the frame pointer table")
+	}
+	data = encodeTestDC6(1, 1, []testFrame{testSprite})
+	data[0] = 7
+	if _, err := LoadDC6Raw(data); err == nil || !strings.Contains(err.Error(), "version 7") {
+		t.Fatalf("Expected an error naming the unsupported version, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	original, err := LoadDC6Raw(encodeTestDC6(1, 2, []testFrame{testSprite, testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := testSprite
+	edited.data = []byte{3, 1, 1, 1, 0x80, 0x81, 1, 5, 0x80}
+	modified, err := LoadDC6Raw(encodeTestDC6(1, 2, []testFrame{testSprite, edited}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := original.Diff(&modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[0].Changed != 0 || !diffs[0].Bounds.Empty() {
+		t.Fatalf("Expected the first frame to be unchanged, got %+v", diffs)
+	}
+	expected := FrameDiff{Direction: 0, Frame: 1, Changed: 1, Bounds: image.Rect(0, 0, 1, 1)}
+	if diffs[1] != expected {
+		t.Fatalf("Expected %+v but got %+v instead", expected, diffs[1])
+	}
+
+	other, err := LoadDC6Raw(encodeTestDC6(2, 1, []testFrame{testSprite, testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := original.Diff(&other); err == nil {
+		t.Fatal("Expected an error when comparing files with different layouts")
+	}
+}
+
+func TestFrameImage(t *testing.T) {
+	palette := testPalette(7)
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range dc6.Frames {
+		frame.palette = palette
+	}
+	var img image.Image = dc6.Frames[0]
+	if img.Bounds() != image.Rect(0, 0, 3, 2) {
+		t.Fatalf("Expected bounds of 3x2 but got %v", img.Bounds())
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Fatal("Expected an unfilled pixel to be transparent")
+	}
+	expected := dc6.Frames[0].RGBA()
+	if img.At(1, 0) != expected.At(1, 0) || img.At(2, 1) != expected.At(2, 1) {
+		t.Fatal("Expected At to match the rendered frame")
+	}
+}
+
+func TestRenderInto(t *testing.T) {
+	palette := testPalette(3)
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := dc6.Frames[0]
+	frame.palette = palette
+	sheet := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	if err := frame.RenderInto(sheet, 4, 1); err != nil {
+		t.Fatal(err)
+	}
+	expected := frame.RGBA()
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			if sheet.RGBAAt(x+4, y+1) != expected.RGBAAt(x, y) {
+				t.Fatalf("Expected pixel (%d, %d) to match the rendered frame", x, y)
+			}
+		}
+	}
+	if err := frame.RenderInto(sheet, 6, 0); err == nil {
+		t.Fatal("Expected an error when the frame does not fit into the destination")
+	}
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	if err := frame.RenderInto(nrgba, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if nrgba.NRGBAAt(1, 0) != color.NRGBAModel.Convert(expected.RGBAAt(1, 0)) || nrgba.NRGBAAt(0, 0).A != 0 {
+		t.Fatal("Expected other destination types to be drawn through Set")
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := frame.RenderInto(sheet, 4, 1); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected rendering into an RGBA image not to allocate, got %v allocations", allocs)
+	}
+}
+
+func TestStats(t *testing.T) {
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 2, []testFrame{testSprite, testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := dc6.Stats(); stats.FramesDecoded != 0 {
+		t.Fatalf("Expected no frames to be decoded after loading, got %+v", stats)
+	}
+	palette := testPalette(1)
+	dc6.Frames[1].ImageData()
+	if stats := dc6.Stats(); stats.FramesDecoded != 0 {
+		t.Fatalf("Expected no stats to be collected before they are enabled, got %+v", stats)
+	}
+	dc6.EnableStats()
+	dc6.Frames[0].RGBAWithPalette(palette)
+	dc6.Frames[0].RGBAWithPalette(palette)
+	dc6.Frames[1].RGBAWithPalette(palette)
+	stats := dc6.Stats()
+	if stats.FramesDecoded != 2 || stats.BytesDecoded != int64(2*len(testSprite.data)) {
+		t.Fatalf("Expected two decoded frames of %d bytes, got %+v", len(testSprite.data), stats)
+	}
+}
+
+func TestRGBAWithRemap(t *testing.T) {
+	palette := testPalette(0)
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var remap [256]byte
+	for i := range remap {
+		remap[i] = byte(i)
+	}
+	remap[2] = 9
+	img := dc6.Frames[0].RGBAWithRemap(palette, remap)
+	if img.RGBAAt(1, 0).G != 9 {
+		t.Fatalf("Expected index 2 to be remapped to index 9, got %v", img.RGBAAt(1, 0))
+	}
+	if img.RGBAAt(0, 1).G != 1 || img.RGBAAt(0, 0).A != 0 {
+		t.Fatal("Expected other pixels to keep their index and transparency")
+	}
+}
+
+func TestRenderReusesBuffers(t *testing.T) {
+	large := testFrame{width: 4, height: 3, data: []byte{4, 7, 7, 7, 7, 0x80, 4, 7, 7, 7, 7, 0x80, 4, 7, 7, 7, 7, 0x80}}
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 2, []testFrame{large, testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc6.SetRGBACacheLimit(0)
+	palette := testPalette(5)
+	for i := 0; i < 3; i++ {
+		dc6.Frames[0].RGBAWithPalette(palette)
+		img := dc6.Frames[1].RGBAWithPalette(palette)
+		if img.RGBAAt(0, 0).A != 0 || img.RGBAAt(1, 0).G != 2 {
+			t.Fatal("Expected a smaller frame rendered after a larger one to be unaffected by its pixels")
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	truncated := testFrame{width: 3, height: 2, data: []byte{3, 1, 1, 1, 0x80, 3, 2}}
+	padded := testFrame{width: 3, height: 2, data: append(append([]byte{}, testSprite.data...), 0, 0)}
+	for _, test := range []struct {
+		frame testFrame
+		valid bool
+	}{
+		{testSprite, true},
+		{truncated, false},
+		{padded, false},
+	} {
+		dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{test.frame}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dc6.Validate(); (err == nil) != test.valid {
+			t.Fatalf("Expected frame data %v to be valid: %v, got %v", test.frame.data, test.valid, err)
+		}
+	}
+}
+
+func TestNormalizeOffsets(t *testing.T) {
+	large := testFrame{width: 4, height: 4, offsetX: 7, offsetY: -3, data: []byte{0x80, 0x80, 0x80, 0x80}}
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 2, []testFrame{testSprite, large}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc6.NormalizeOffsets(10, 20)
+	for frame := 0; frame < 2; frame++ {
+		img, origin, err := dc6.FrameImage(0, frame, testPalette(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		center := origin.Add(image.Pt(img.Rect.Dx()/2, img.Rect.Dy()/2))
+		if center != image.Pt(10, 20) {
+			t.Fatalf("Expected frame %d to be centered on the anchor, got %v", frame, center)
+		}
+	}
+}
+
+func TestDirectionBounds(t *testing.T) {
+	large := testFrame{width: 4, height: 4, offsetX: 7, offsetY: -3, data: []byte{0x80, 0x80, 0x80, 0x80}}
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 2, []testFrame{testSprite, large}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := dc6.DirectionBounds(0); bounds != image.Rect(-1, -7, 11, 2) {
+		t.Fatalf("Expected the union of both frames, got %v", bounds)
+	}
+	if bounds := dc6.DirectionBounds(1); !bounds.Empty() {
+		t.Fatalf("Expected an out of range direction to be empty, got %v", bounds)
+	}
+}
+
+func TestFrameHeaders(t *testing.T) {
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := dc6.FrameHeaders()
+	expected := FrameHeader{Width: 3, Height: 2, OffsetX: -1, OffsetY: 2}
+	if len(headers) != 1 || headers[0] != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, headers)
+	}
+	if stats := dc6.Stats(); stats.FramesDecoded != 0 {
+		t.Fatalf("Expected no frames to be decoded, got %d", stats.FramesDecoded)
+	}
+}
+
+func TestOnionSkin(t *testing.T) {
+	shifted := testSprite
+	shifted.offsetX = 5
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 2, []testFrame{testSprite, shifted}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range dc6.Frames {
+		frame.palette = testPalette(3)
+	}
+	if _, err := dc6.OnionSkin(1, 0, 1); err == nil {
+		t.Fatal("Expected an error for a direction out of range")
+	}
+	img, err := dc6.OnionSkin(0, -3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Rect != image.Rect(-1, 0, 8, 2) {
+		t.Fatalf("Expected the image to cover both frames, got %v", img.Rect)
+	}
+	if alpha := img.RGBAAt(-1, 1).A; alpha != 0xFF {
+		t.Fatalf("Expected the center frame to be opaque, got alpha %d", alpha)
+	}
+	if alpha := img.RGBAAt(5, 1).A; alpha != 0x7F {
+		t.Fatalf("Expected the neighbouring frame to be faded, got alpha %d", alpha)
+	}
+	if alpha := img.RGBAAt(-1, 0).A; alpha != 0 {
+		t.Fatalf("Expected unfilled pixels to stay transparent, got alpha %d", alpha)
+	}
+}
+
+func TestExportSheet(t *testing.T) {
+	large := testFrame{width: 4, height: 1, offsetX: 7, offsetY: -3, data: []byte{4, 1, 2, 3, 4, 0x80}}
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 3, []testFrame{testSprite, large, testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range dc6.Frames {
+		frame.palette = testPalette(3)
+	}
+	if err := dc6.ExportSheet(ioutil.Discard, ioutil.Discard, 0); err == nil {
+		t.Fatal("Expected an error for a sheet without columns")
+	}
+	var sheetData, metaData bytes.Buffer
+	if err := dc6.ExportSheet(&sheetData, &metaData, 2); err != nil {
+		t.Fatal(err)
+	}
+	sheet, err := png.Decode(&sheetData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sheet.Bounds() != image.Rect(0, 0, 8, 4) {
+		t.Fatalf("Expected a 2x2 grid of 4x2 cells, got %v", sheet.Bounds())
+	}
+	var meta SheetMeta
+	if err := json.Unmarshal(metaData.Bytes(), &meta); err != nil {
+		t.Fatal(err)
+	}
+	expected := SheetFrame{Direction: 0, Frame: 1, X: 4, Y: 0, Width: 4, Height: 1, OffsetX: 7, OffsetY: -3}
+	if len(meta.Frames) != 3 || meta.Frames[1] != expected || meta.Frames[2].Y != 2 {
+		t.Fatalf("Expected the frames to be placed in a grid, got %+v", meta.Frames)
+	}
+	if _, _, _, a := sheet.At(4, 0).RGBA(); a == 0 {
+		t.Fatal("Expected the second frame to be rendered into its cell")
+	}
+}
+
+func TestASCIIArt(t *testing.T) {
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{testSprite}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if art := dc6.Frames[0].ASCIIArt(3); art != ":#:\n" {
+		t.Fatalf("Expected a single row preview, got %q", art)
+	}
+	if art := dc6.Frames[0].ASCIIArt(0); art != "" {
+		t.Fatalf("Expected no preview without columns, got %q", art)
+	}
+}
+
+func TestEncodeDirectionGIF(t *testing.T) {
+	shifted := testSprite
+	shifted.offsetX = 5
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 2, []testFrame{testSprite, shifted}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range dc6.Frames {
+		frame.palette = testPalette(3)
+	}
+	if err := dc6.EncodeDirectionGIF(1, ioutil.Discard, 10); err == nil {
+		t.Fatal("Expected an error for a direction out of range")
+	}
+	var data bytes.Buffer
+	if err := dc6.EncodeDirectionGIF(0, &data, 10); err != nil {
+		t.Fatal(err)
+	}
+	animation, err := gif.DecodeAll(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animation.Image) != 2 || animation.Delay[1] != 10 || animation.LoopCount != 0 {
+		t.Fatalf("Expected a looping animation of 2 frames, got %d frames", len(animation.Image))
+	}
+	if animation.Config.Width != 9 || animation.Config.Height != 2 {
+		t.Fatalf("Expected a 9x2 canvas, got %dx%d", animation.Config.Width, animation.Config.Height)
+	}
+	second := animation.Image[1]
+	if second.Rect != image.Rect(6, 0, 9, 2) {
+		t.Fatalf("Expected the second frame to be placed by its offset, got %v", second.Rect)
+	}
+	if _, _, _, a := second.At(6, 0).RGBA(); a != 0 {
+		t.Fatal("Expected pixels that are not filled to be transparent")
+	}
+	if second.ColorIndexAt(6, 1) != 1 {
+		t.Fatalf("Expected filled pixels to keep their palette index, got %d", second.ColorIndexAt(6, 1))
+	}
+}
+
+func TestTransforms(t *testing.T) {
+	dc6, err := LoadDC6Raw(encodeTestDC6(1, 1, []testFrame{{width: 2, height: 1, data: []byte{2, 1, 2, 0x80}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := dc6.Frames[0]
+	frame.palette = testPalette(3)
+	flipped := frame.FlippedHorizontal()
+	if flipped.Bounds() != image.Rect(0, 0, 2, 1) || flipped.RGBAAt(0, 0).R != 5 || flipped.RGBAAt(1, 0).R != 4 {
+		t.Fatalf("Expected the pixels to be mirrored, got %v", flipped.Pix)
+	}
+	rotated := frame.Rotate90()
+	if rotated.Bounds() != image.Rect(0, 0, 1, 2) || rotated.RGBAAt(0, 0).R != 4 || rotated.RGBAAt(0, 1).R != 5 {
+		t.Fatalf("Expected the pixels to be rotated clockwise, got %v", rotated.Pix)
+	}
+}
@@ -0,0 +1,36 @@
+package d2dc6
+
+import "image"
+
+// FlippedHorizontal renders the frame with the palette bound at load time, mirrored left to right. The result is a
+// new image that is not cached.
+func (v *DC6Frame) FlippedHorizontal() *image.RGBA {
+	width, height := int(v.Width), int(v.Height)
+	return v.transformed(width, height, func(x, y int) (int, int) {
+		return width - 1 - x, y
+	})
+}
+
+// Rotate90 renders the frame with the palette bound at load time, rotated 90 degrees clockwise. The result is a new
+// image that is Height pixels wide and Width pixels tall, and is not cached.
+func (v *DC6Frame) Rotate90() *image.RGBA {
+	height := int(v.Height)
+	return v.transformed(height, int(v.Width), func(x, y int) (int, int) {
+		return y, height - 1 - x
+	})
+}
+
+// transformed builds an image of the given size, where source returns the frame pixel that a pixel of the result
+// shows
+func (v *DC6Frame) transformed(width, height int, source func(x, y int) (int, int)) *image.RGBA {
+	src := v.RGBA()
+	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			srcX, srcY := source(x, y)
+			srcOffset := src.PixOffset(srcX, srcY)
+			copy(result.Pix[result.PixOffset(x, y):], src.Pix[srcOffset:srcOffset+4])
+		}
+	}
+	return result
+}
@@ -1,6 +1,8 @@
 package d2dcc
 
 import (
+	"errors"
+	"fmt"
 	"log"
 
 	"github.com/OpenDiablo2/D2Shared/d2common/d2interface"
@@ -21,29 +23,56 @@ func (v DCC) IsValid() bool {
 	return v.valid
 }
 
+// LoadDCC loads a DCC file. An empty file results in a DCC that is not valid.
 func LoadDCC(path string, fileProvider d2interface.FileProvider) DCC {
-	result := DCC{}
 	fileData := fileProvider.LoadFile(path)
 	if len(fileData) == 0 {
 		ret := DCC{}
 		ret.valid = false
 		return ret
 	}
+	result, err := LoadDCCRaw(fileData)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return result
+}
+
+// LoadDCCRaw parses the content of a DCC file
+func LoadDCCRaw(fileData []byte) (DCC, error) {
+	result := DCC{}
+	if len(fileData) == 0 {
+		return result, errors.New("dcc data is empty")
+	}
 	var bm = d2common.CreateBitMuncher(fileData, 0)
-	result.Signature = int(bm.GetByte())
+	var header [6]uint32 // Signature, version, directions, frames per direction, 1, total size coded
+	for i, bits := range []int{8, 8, 8, 32, 32, 32} {
+		value, err := bm.ReadBits(bits)
+		if err != nil {
+			return DCC{}, errors.New("dcc header is truncated")
+		}
+		header[i] = value
+	}
+	result.Signature = int(header[0])
 	if result.Signature != 0x74 {
-		log.Fatal("Signature expected to be 0x74 but it is not.")
+		return DCC{}, fmt.Errorf("dcc signature is %#x, expected 0x74", result.Signature)
+	}
+	result.Version = int(header[1])
+	result.NumberOfDirections = int(header[2])
+	result.FramesPerDirection = int(int32(header[3]))
+	if header[4] != 1 {
+		return DCC{}, errors.New("dcc header value is not 1, it has to be 1")
 	}
-	result.Version = int(bm.GetByte())
-	result.NumberOfDirections = int(bm.GetByte())
-	result.FramesPerDirection = int(bm.GetInt32())
-	if bm.GetInt32() != 1 {
-		log.Fatal("This value isn't 1. It has to be 1.")
+	if result.FramesPerDirection < 0 {
+		return DCC{}, fmt.Errorf("dcc frame count %d is negative", result.FramesPerDirection)
 	}
-	bm.GetInt32() // TotalSizeCoded
 	directionOffsets := make([]int, result.NumberOfDirections)
 	for i := 0; i < result.NumberOfDirections; i++ {
-		directionOffsets[i] = int(bm.GetInt32())
+		offset, err := bm.ReadBits(32)
+		if err != nil {
+			return DCC{}, errors.New("dcc direction offsets are truncated")
+		}
+		directionOffsets[i] = int(offset)
 	}
 	result.Directions = make([]DCCDirection, result.NumberOfDirections)
 	for i := 0; i < result.NumberOfDirections; i++ {
@@ -60,8 +89,22 @@ func LoadDCC(path string, fileProvider d2interface.FileProvider) DCC {
 		case 32:
 			dir = dccDir32[i]
 		}
-		result.Directions[dir] = CreateDCCDirection(d2common.CreateBitMuncher(fileData, directionOffsets[i]*8), result)
+		direction, err := CreateDCCDirection(d2common.CreateBitMuncher(fileData, directionOffsets[i]*8), result)
+		if err != nil {
+			return DCC{}, fmt.Errorf("dcc direction %d: %v", i, err)
+		}
+		result.Directions[dir] = direction
 	}
 	result.valid = true
-	return result
+	return result, nil
+}
+
+// DirectionCount returns the number of directions in the file
+func (v DCC) DirectionCount() int {
+	return v.NumberOfDirections
+}
+
+// FrameCount returns the number of frames in each direction
+func (v DCC) FrameCount() int {
+	return v.FramesPerDirection
 }
@@ -1,7 +1,8 @@
 package d2dcc
 
 import (
-	"log"
+	"errors"
+	"fmt"
 
 	"github.com/OpenDiablo2/D2Shared/d2common"
 	"github.com/OpenDiablo2/D2Shared/d2helper"
@@ -31,17 +32,35 @@ type DCCDirection struct {
 	PixelBuffer                []DCCPixelBufferEntry
 }
 
-func CreateDCCDirection(bm *d2common.BitMuncher, file DCC) DCCDirection {
+// CreateDCCDirection decodes a direction, with the frames of the file. It returns an error if the data is truncated
+// or uses a feature that is not supported.
+func CreateDCCDirection(bm *d2common.BitMuncher, file DCC) (DCCDirection, error) {
 	result := DCCDirection{}
-	result.OutSizeCoded = int(bm.GetUInt32())
-	result.CompressionFlags = int(bm.GetBits(2))
-	result.Variable0Bits = int(crazyBitTable[bm.GetBits(4)])
-	result.WidthBits = int(crazyBitTable[bm.GetBits(4)])
-	result.HeightBits = int(crazyBitTable[bm.GetBits(4)])
-	result.XOffsetBits = int(crazyBitTable[bm.GetBits(4)])
-	result.YOffsetBits = int(crazyBitTable[bm.GetBits(4)])
-	result.OptionalDataBits = int(crazyBitTable[bm.GetBits(4)])
-	result.CodedBytesBits = int(crazyBitTable[bm.GetBits(4)])
+	outSizeCoded, err := bm.ReadBits(32)
+	if err != nil {
+		return result, err
+	}
+	result.OutSizeCoded = int(outSizeCoded)
+	compressionFlags, err := bm.ReadBits(2)
+	if err != nil {
+		return result, err
+	}
+	result.CompressionFlags = int(compressionFlags)
+	for _, bits := range []*int{
+		&result.Variable0Bits,
+		&result.WidthBits,
+		&result.HeightBits,
+		&result.XOffsetBits,
+		&result.YOffsetBits,
+		&result.OptionalDataBits,
+		&result.CodedBytesBits,
+	} {
+		code, err := bm.ReadBits(4)
+		if err != nil {
+			return result, err
+		}
+		*bits = int(crazyBitTable[code])
+	}
 	result.Frames = make([]*DCCDirectionFrame, file.FramesPerDirection)
 	minx := 100000
 	miny := 100000
@@ -49,29 +68,40 @@ func CreateDCCDirection(bm *d2common.BitMuncher, file DCC) DCCDirection {
 	maxy := -100000
 	// Load the frame headers
 	for frameIdx := 0; frameIdx < file.FramesPerDirection; frameIdx++ {
-		result.Frames[frameIdx] = CreateDCCDirectionFrame(bm, result)
+		if result.Frames[frameIdx], err = CreateDCCDirectionFrame(bm, result); err != nil {
+			return result, fmt.Errorf("frame %d: %v", frameIdx, err)
+		}
 		minx = int(d2helper.MinInt32(int32(result.Frames[frameIdx].Box.Left), int32(minx)))
 		miny = int(d2helper.MinInt32(int32(result.Frames[frameIdx].Box.Top), int32(miny)))
 		maxx = int(d2helper.MaxInt32(int32(result.Frames[frameIdx].Box.Right()), int32(maxx)))
 		maxy = int(d2helper.MaxInt32(int32(result.Frames[frameIdx].Box.Bottom()), int32(maxy)))
 	}
-	result.Box = d2common.Rectangle{minx, miny, (maxx - minx), (maxy - miny)}
+	result.Box = d2common.Rectangle{Left: minx, Top: miny, Width: maxx - minx, Height: maxy - miny}
 	if result.OptionalDataBits > 0 {
-		log.Panic("Optional bits in DCC data is not currently supported.")
+		return result, errors.New("optional bits in dcc data are not supported")
 	}
+	streamSizes := []*int{&result.PixelMaskBitstreamSize}
 	if (result.CompressionFlags & 0x2) > 0 {
-		result.EqualCellsBitstreamSize = int(bm.GetBits(20))
+		streamSizes = []*int{&result.EqualCellsBitstreamSize, &result.PixelMaskBitstreamSize}
 	}
-	result.PixelMaskBitstreamSize = int(bm.GetBits(20))
 	if (result.CompressionFlags & 0x1) > 0 {
-		result.EncodingTypeBitsreamSize = int(bm.GetBits(20))
-		result.RawPixelCodesBitstreamSize = int(bm.GetBits(20))
+		streamSizes = append(streamSizes, &result.EncodingTypeBitsreamSize, &result.RawPixelCodesBitstreamSize)
+	}
+	for _, size := range streamSizes {
+		value, err := bm.ReadBits(20)
+		if err != nil {
+			return result, err
+		}
+		*size = int(value)
 	}
 	// PixelValuesKey
 	paletteEntryCount := 0
 	for i := 0; i < 256; i++ {
-		valid := bm.GetBit() != 0
-		if valid {
+		valid, err := bm.ReadBits(1)
+		if err != nil {
+			return result, err
+		}
+		if valid != 0 {
 			result.PaletteEntries[paletteEntryCount] = byte(i)
 			paletteEntryCount++
 		}
@@ -97,28 +127,39 @@ func CreateDCCDirection(bm *d2common.BitMuncher, file DCC) DCCDirection {
 		frame.CalculateCells(result)
 	}
 	// Fill in the pixel buffer
-	result.FillPixelBuffer(pixelCodeandDisplacement, equalCellsBitstream, pixelMaskBitstream, encodingTypeBitsream, rawPixelCodesBitstream)
+	err = result.FillPixelBuffer(pixelCodeandDisplacement, equalCellsBitstream, pixelMaskBitstream, encodingTypeBitsream,
+		rawPixelCodesBitstream)
+	if err != nil {
+		return result, err
+	}
 	// Generate the actual frame pixel data
-	result.GenerateFrames(pixelCodeandDisplacement)
+	if err = result.GenerateFrames(pixelCodeandDisplacement); err != nil {
+		return result, err
+	}
 	result.PixelBuffer = nil
 	// Verify that everything we expected to read was actually read (sanity check)...
 	if equalCellsBitstream.BitsRead != result.EqualCellsBitstreamSize {
-		log.Panic("Did not read the correct number of bits!")
+		return result, errors.New("did not read the whole equal cells stream")
 	}
 	if pixelMaskBitstream.BitsRead != result.PixelMaskBitstreamSize {
-		log.Panic("Did not read the correct number of bits!")
+		return result, errors.New("did not read the whole pixel mask stream")
 	}
 	if encodingTypeBitsream.BitsRead != result.EncodingTypeBitsreamSize {
-		log.Panic("Did not read the correct number of bits!")
+		return result, errors.New("did not read the whole encoding type stream")
 	}
 	if rawPixelCodesBitstream.BitsRead != result.RawPixelCodesBitstreamSize {
-		log.Panic("Did not read the correct number of bits!")
+		return result, errors.New("did not read the whole raw pixel codes stream")
 	}
 	bm.SkipBits(pixelCodeandDisplacement.BitsRead)
-	return result
+	return result, nil
 }
 
-func (v *DCCDirection) GenerateFrames(pcd *d2common.BitMuncher) {
+// GenerateFrames renders the frames from the pixel buffer. Cells are drawn into a buffer the size of the direction box
+// that keeps the pixels between frames. A cell whose equal cell bit is set has no pixel buffer entry; it copies the
+// pixels the same buffer cell had in the previous frame if the size of the cell is unchanged, and is cleared otherwise.
+// Other cells are filled with their entry's first color if the first two colors are equal, and with 1 or 2 bit
+// indices into the entry's colors read from the pixel code stream otherwise.
+func (v *DCCDirection) GenerateFrames(pcd *d2common.BitMuncher) error {
 	pbIdx := 0
 	for _, cell := range v.Cells {
 		cell.LastWidth = -1
@@ -140,11 +181,11 @@ func (v *DCCDirection) GenerateFrames(pcd *d2common.BitMuncher) {
 			if (pbe.Frame != frameIndex) || (pbe.FrameCellIndex != c) {
 				// This buffer cell has an EqualCell bit set to 1, so copy the frame cell or clear it
 				if (cell.Width != bufferCell.LastWidth) || (cell.Height != bufferCell.LastHeight) {
-					// Different sizes
-					/// TODO: Clear the pixels of the frame cell
+					// Different sizes, so there is nothing to copy and the cell is cleared. The frame image is
+					// already clear. The buffer spans the direction box, so rows are Box.Width apart.
 					for y := 0; y < cell.Height; y++ {
 						for x := 0; x < cell.Width; x++ {
-							v.PixelData[x+cell.XOffset+((y+cell.YOffset)*frame.Width)] = 0
+							v.PixelData[x+cell.XOffset+((y+cell.YOffset)*v.Box.Width)] = 0
 						}
 					}
 				} else {
@@ -183,7 +224,10 @@ func (v *DCCDirection) GenerateFrames(pcd *d2common.BitMuncher) {
 					}
 					for y := 0; y < cell.Height; y++ {
 						for x := 0; x < cell.Width; x++ {
-							paletteIndex := pcd.GetBits(bitsToRead)
+							paletteIndex, err := pcd.ReadBits(bitsToRead)
+							if err != nil {
+								return err
+							}
 							v.PixelData[x+cell.XOffset+((y+cell.YOffset)*v.Box.Width)] = pbe.Value[paletteIndex]
 						}
 					}
@@ -208,9 +252,14 @@ func (v *DCCDirection) GenerateFrames(pcd *d2common.BitMuncher) {
 	v.Cells = nil
 	v.PixelData = nil
 	v.PixelBuffer = nil
+	return nil
 }
 
-func (v *DCCDirection) FillPixelBuffer(pcd, ec, pm, et, rp *d2common.BitMuncher) {
+// FillPixelBuffer decodes the colors of every frame cell into the pixel buffer. The first time a buffer cell is used,
+// all four of its colors are decoded. After that, the equal cells stream has a bit telling whether the cell is the same
+// as in the previous frame, in which case no entry is added, and otherwise the pixel mask stream has 4 bits telling
+// which of the four colors change. The unchanged colors are taken from the cell's previous entry.
+func (v *DCCDirection) FillPixelBuffer(pcd, ec, pm, et, rp *d2common.BitMuncher) error {
 	lastPixel := uint32(0)
 	maxCellX := 0
 	maxCellY := 0
@@ -242,12 +291,17 @@ func (v *DCCDirection) FillPixelBuffer(pcd, ec, pm, et, rp *d2common.BitMuncher)
 				tmp := 0
 				if cellBuffer[currentCell] != nil {
 					if v.EqualCellsBitstreamSize > 0 {
-						tmp = int(ec.GetBit())
-					} else {
-						tmp = 0
+						equalCell, err := ec.ReadBits(1)
+						if err != nil {
+							return err
+						}
+						tmp = int(equalCell)
 					}
 					if tmp == 0 {
-						pixelMask = pm.GetBits(4)
+						var err error
+						if pixelMask, err = pm.ReadBits(4); err != nil {
+							return err
+						}
 					} else {
 						nextCell = true
 					}
@@ -263,20 +317,31 @@ func (v *DCCDirection) FillPixelBuffer(pcd, ec, pm, et, rp *d2common.BitMuncher)
 				numberOfPixelBits := pixelMaskLookup[pixelMask]
 				encodingType := 0
 				if (numberOfPixelBits != 0) && (v.EncodingTypeBitsreamSize > 0) {
-					encodingType = int(et.GetBit())
-				} else {
-					encodingType = 0
+					encodingTypeBit, err := et.ReadBits(1)
+					if err != nil {
+						return err
+					}
+					encodingType = int(encodingTypeBit)
 				}
 				decodedPixel := 0
 				for i := 0; i < numberOfPixelBits; i++ {
 					if encodingType != 0 {
-						pixelStack[i] = rp.GetBits(8)
+						rawPixel, err := rp.ReadBits(8)
+						if err != nil {
+							return err
+						}
+						pixelStack[i] = rawPixel
 					} else {
 						pixelStack[i] = lastPixel
-						pixelDisplacement := pcd.GetBits(4)
+						pixelDisplacement, err := pcd.ReadBits(4)
+						if err != nil {
+							return err
+						}
 						pixelStack[i] += pixelDisplacement
 						for pixelDisplacement == 15 {
-							pixelDisplacement = pcd.GetBits(4)
+							if pixelDisplacement, err = pcd.ReadBits(4); err != nil {
+								return err
+							}
 							pixelStack[i] += pixelDisplacement
 						}
 					}
@@ -316,6 +381,7 @@ func (v *DCCDirection) FillPixelBuffer(pcd, ec, pm, et, rp *d2common.BitMuncher)
 			v.PixelBuffer[i].Value[x] = v.PaletteEntries[v.PixelBuffer[i].Value[x]]
 		}
 	}
+	return nil
 }
 
 func (v *DCCDirection) CalculateCells() {
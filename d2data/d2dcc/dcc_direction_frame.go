@@ -1,7 +1,7 @@
 package d2dcc
 
 import (
-	"log"
+	"errors"
 
 	"github.com/OpenDiablo2/D2Shared/d2common"
 )
@@ -22,28 +22,53 @@ type DCCDirectionFrame struct {
 	valid                 bool
 }
 
-func CreateDCCDirectionFrame(bits *d2common.BitMuncher, direction DCCDirection) *DCCDirectionFrame {
+// CreateDCCDirectionFrame reads a frame header. It returns an error if the header is truncated, or the frame is stored
+// bottom up, which is not supported.
+func CreateDCCDirectionFrame(bits *d2common.BitMuncher, direction DCCDirection) (*DCCDirectionFrame, error) {
 	result := &DCCDirectionFrame{}
-	bits.GetBits(direction.Variable0Bits) // Variable0
-	result.Width = int(bits.GetBits(direction.WidthBits))
-	result.Height = int(bits.GetBits(direction.HeightBits))
-	result.XOffset = bits.GetSignedBits(direction.XOffsetBits)
-	result.YOffset = bits.GetSignedBits(direction.YOffsetBits)
-	result.NumberOfOptionalBytes = int(bits.GetBits(direction.OptionalDataBits))
-	result.NumberOfCodedBytes = int(bits.GetBits(direction.CodedBytesBits))
-	result.FrameIsBottomUp = bits.GetBit() == 1
-	if result.FrameIsBottomUp {
-		log.Panic("Bottom up frames are not implemented.")
-	} else {
-		result.Box = d2common.Rectangle{
-			result.XOffset,
-			result.YOffset - result.Height + 1,
-			result.Width,
-			result.Height,
+	fields := []struct {
+		bits   int
+		signed bool
+		value  *int
+	}{
+		{direction.Variable0Bits, false, nil},
+		{direction.WidthBits, false, &result.Width},
+		{direction.HeightBits, false, &result.Height},
+		{direction.XOffsetBits, true, &result.XOffset},
+		{direction.YOffsetBits, true, &result.YOffset},
+		{direction.OptionalDataBits, false, &result.NumberOfOptionalBytes},
+		{direction.CodedBytesBits, false, &result.NumberOfCodedBytes},
+	}
+	for _, field := range fields {
+		value, err := bits.ReadBits(field.bits)
+		if err != nil {
+			return nil, err
+		}
+		if field.value == nil {
+			continue
+		}
+		if field.signed {
+			*field.value = int(bits.MakeSigned(value, field.bits))
+		} else {
+			*field.value = int(value)
 		}
 	}
+	bottomUp, err := bits.ReadBits(1)
+	if err != nil {
+		return nil, err
+	}
+	result.FrameIsBottomUp = bottomUp == 1
+	if result.FrameIsBottomUp {
+		return nil, errors.New("bottom up frames are not implemented")
+	}
+	result.Box = d2common.Rectangle{
+		Left:   result.XOffset,
+		Top:    result.YOffset - result.Height + 1,
+		Width:  result.Width,
+		Height: result.Height,
+	}
 	result.valid = true
-	return result
+	return result, nil
 }
 
 func (v *DCCDirectionFrame) CalculateCells(direction DCCDirection) {
@@ -0,0 +1,30 @@
+package d2dcc
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+// FrameImage renders a frame with the palette, and returns it with the position of its top left corner relative to
+// the sprite origin. Palette index 0 is transparent.
+func (v DCC) FrameImage(direction, frame int, palette d2datadict.PaletteRec) (*image.RGBA, image.Point, error) {
+	if direction < 0 || direction >= len(v.Directions) || frame < 0 || frame >= len(v.Directions[direction].Frames) {
+		return nil, image.Point{}, fmt.Errorf("dcc frame %d of direction %d is out of range", frame, direction)
+	}
+	dccDirection := v.Directions[direction]
+	dccFrame := dccDirection.Frames[frame]
+	result := image.NewRGBA(image.Rect(0, 0, dccDirection.Box.Width, dccDirection.Box.Height))
+	for i, paletteIndex := range dccFrame.PixelData {
+		if paletteIndex == 0 {
+			continue
+		}
+		color := palette.Colors[paletteIndex]
+		result.Pix[i*4] = color.R
+		result.Pix[(i*4)+1] = color.G
+		result.Pix[(i*4)+2] = color.B
+		result.Pix[(i*4)+3] = 0xFF
+	}
+	return result, image.Pt(dccDirection.Box.Left, dccDirection.Box.Top), nil
+}
@@ -0,0 +1,172 @@
+package d2dcc
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// testBits is a value written to a test bit stream, least significant bit first
+type testBits struct {
+	value uint32
+	bits  int
+}
+
+// bitWriter builds bit streams the way BitMuncher reads them
+type bitWriter struct {
+	data []byte
+	bits int
+}
+
+func (v *bitWriter) write(values ...testBits) {
+	for _, value := range values {
+		for i := 0; i < value.bits; i++ {
+			if v.bits%8 == 0 {
+				v.data = append(v.data, 0)
+			}
+			v.data[v.bits/8] |= byte((value.value>>uint(i))&1) << uint(v.bits%8)
+			v.bits++
+		}
+	}
+}
+
+func (v *bitWriter) size(values []testBits) int {
+	result := 0
+	for _, value := range values {
+		result += value.bits
+	}
+	return result
+}
+
+// testDCCFrame is the header of a frame in a test DCC file. The frame spans from (x, y - height + 1) to
+// (x + width - 1, y).
+type testDCCFrame struct {
+	width, height, x, y int
+}
+
+// testPaletteEntries are the palette indices the test files use, so pixel value i is palette index i * 10
+const testPaletteEntries = 4
+
+// encodeTestDCC builds a DCC file with one direction holding the frames. Frame headers use 8 bits per field. The
+// equal cells stream is only present when equalCells is not nil.
+func encodeTestDCC(frames []testDCCFrame, equalCells, pixelMask, pixelCodes []testBits) []byte {
+	direction := &bitWriter{}
+	compressionFlags := uint32(0)
+	if equalCells != nil {
+		compressionFlags = 2
+	}
+	direction.write(testBits{0, 32}, testBits{compressionFlags, 2}, testBits{0, 4})
+	for i := 0; i < 4; i++ {
+		direction.write(testBits{5, 4}) // Width, height, x and y offsets use 8 bits
+	}
+	direction.write(testBits{0, 4}, testBits{0, 4})
+	for _, frame := range frames {
+		direction.write(testBits{uint32(frame.width), 8}, testBits{uint32(frame.height), 8},
+			testBits{uint32(frame.x), 8}, testBits{uint32(frame.y), 8}, testBits{0, 1})
+	}
+	if equalCells != nil {
+		direction.write(testBits{uint32(direction.size(equalCells)), 20})
+	}
+	direction.write(testBits{uint32(direction.size(pixelMask)), 20})
+	for i := 0; i < 256; i++ {
+		valid := uint32(0)
+		if i%10 == 0 && i/10 < testPaletteEntries {
+			valid = 1
+		}
+		direction.write(testBits{valid, 1})
+	}
+	direction.write(equalCells...)
+	direction.write(pixelMask...)
+	direction.write(pixelCodes...)
+	const headerSize = 19
+	header := make([]byte, headerSize)
+	header[0] = 0x74
+	header[1] = 6
+	header[2] = 1
+	binary.LittleEndian.PutUint32(header[3:], uint32(len(frames)))
+	binary.LittleEndian.PutUint32(header[7:], 1)
+	binary.LittleEndian.PutUint32(header[15:], headerSize)
+	return append(header, direction.data...)
+}
+
+// solidCellCodes returns the pixel codes of a new 4x4 cell filled with the pixel value, which must not be 0. The colors
+// are a displacement to the value followed by a repeated color that ends the list. The pixels are 1 bit indices into the
+// decoded colors, all selecting the value.
+func solidCellCodes(value uint32) (colors []testBits, pixels []testBits) {
+	return []testBits{{value, 4}, {0, 4}}, []testBits{{0, 16}}
+}
+
+func TestLoadDCCTruncated(t *testing.T) {
+	colors, pixels := solidCellCodes(1)
+	data := encodeTestDCC([]testDCCFrame{{width: 4, height: 4, y: 3}}, nil, nil, append(colors, pixels...))
+	dcc, err := LoadDCCRaw(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pixel := dcc.Directions[0].Frames[0].PixelData[0]; pixel != 10 {
+		t.Fatalf("Expected the frame to be filled with palette index 10, got %d", pixel)
+	}
+	for length := 1; length < len(data); length++ {
+		if _, err := LoadDCCRaw(data[:length]); err == nil {
+			t.Fatalf("Expected an error for the first %d bytes of the file", length)
+		}
+	}
+}
+
+func TestLoadDCCEqualCells(t *testing.T) {
+	// Frame 0 is two cells, filled with 10 and 20. Frame 1 is 3 pixels wide, so its single cell changes size and is
+	// cleared. Frame 2 is two cells again: the first changes size back and is cleared, and the second is unchanged
+	// since frame 0 and copies its pixels.
+	frames := []testDCCFrame{
+		{width: 8, height: 4, y: 3},
+		{width: 3, height: 4, y: 3},
+		{width: 8, height: 4, y: 3},
+	}
+	equalCells := []testBits{{1, 1}, {1, 1}, {1, 1}}
+	leftColors, leftPixels := solidCellCodes(1)
+	rightColors, rightPixels := solidCellCodes(2)
+	var pixelCodes []testBits
+	pixelCodes = append(append(pixelCodes, leftColors...), rightColors...)
+	pixelCodes = append(append(pixelCodes, leftPixels...), rightPixels...)
+	dcc, err := LoadDCCRaw(encodeTestDCC(frames, equalCells, nil, pixelCodes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	direction := dcc.Directions[0]
+	if direction.Box.Width != 8 || direction.Box.Height != 4 {
+		t.Fatalf("Expected an 8x4 direction, got %+v", direction.Box)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			left, right := byte(0), byte(20)
+			if x < 4 {
+				left, right = 10, 0
+			}
+			expected := []byte{left + right, 0, right}
+			for frameIndex, frame := range direction.Frames {
+				if pixel := frame.PixelData[x+(y*8)]; pixel != expected[frameIndex] {
+					t.Fatalf("Expected pixel (%d, %d) of frame %d to be %d, got %d",
+						x, y, frameIndex, expected[frameIndex], pixel)
+				}
+			}
+		}
+	}
+}
+
+func TestLoadDCCPixelMask(t *testing.T) {
+	// Frame 1 keeps the cell of frame 0, but its pixel mask replaces the first of the four colors
+	frames := []testDCCFrame{{width: 4, height: 4, y: 3}, {width: 4, height: 4, y: 3}}
+	colors, pixels := solidCellCodes(1)
+	// The colors of all frames come before the pixels of all frames
+	pixelCodes := append(append(append(colors, testBits{3, 4}), pixels...), testBits{0, 16})
+	dcc, err := LoadDCCRaw(encodeTestDCC(frames, []testBits{{0, 1}}, []testBits{{1, 4}}, pixelCodes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	direction := dcc.Directions[0]
+	// The new first color is 3, and the second color kept from frame 0 is 0, so every 1 bit code selects color 3
+	for i, pixel := range direction.Frames[1].PixelData {
+		if pixel != 30 {
+			t.Fatalf("Expected pixel %d of frame 1 to be 30, got %d", i, pixel)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package d2ds1
+
+import "github.com/OpenDiablo2/D2Shared/d2data/d2dt1"
+
+// CollisionGrid returns, indexed by [y][x], which sub-tiles of the map block walking. Every tile is divided into 5x5
+// sub-tiles, and the masks of the DT1 tiles used by the floors and walls of each tile are combined. Hidden and empty
+// records are left out.
+func (v *DS1) CollisionGrid(dt1s ...*d2dt1.DT1) [][]bool {
+	result := make([][]bool, v.Height*5)
+	for y := range result {
+		result[y] = make([]bool, v.Width*5)
+	}
+	for y := 0; y < int(v.Height); y++ {
+		for x := 0; x < int(v.Width); x++ {
+			tile := &v.Tiles[y][x]
+			for _, floor := range tile.Floors {
+				if floor.Hidden || floor.Prop1 == 0 {
+					continue
+				}
+				floorTile := findTile(dt1s, int32(floor.Orientation()), floor.MainIndex, floor.SubIndex)
+				applyCollisionMask(result, x, y, floorTile)
+			}
+			for _, wall := range tile.Walls {
+				if wall.Hidden || wall.Prop1 == 0 {
+					continue
+				}
+				applyCollisionMask(result, x, y, findTile(dt1s, int32(wall.Orientation), wall.MainIndex, wall.SubIndex))
+			}
+		}
+	}
+	return result
+}
+
+func applyCollisionMask(grid [][]bool, x, y int, tile *d2dt1.Tile) {
+	if tile == nil {
+		return
+	}
+	mask := tile.CollisionMask()
+	for subY := range mask {
+		for subX := range mask[subY] {
+			if mask[subY][subX] {
+				grid[(y*5)+subY][(x*5)+subX] = true
+			}
+		}
+	}
+}
+
+// findTile returns the first DT1 tile with the given orientation and indices
+func findTile(dt1s []*d2dt1.DT1, orientation int32, mainIndex, subIndex byte) *d2dt1.Tile {
+	for _, dt1 := range dt1s {
+		for idx := range dt1.Tiles {
+			tile := &dt1.Tiles[idx]
+			if tile.Orientation == orientation && tile.MainIndex == int32(mainIndex) && tile.SubIndex == int32(subIndex) {
+				return tile
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package d2ds1
+
+import (
+	"fmt"
+
+	"github.com/OpenDiablo2/D2Shared/d2data"
+)
+
+// subtilesPerTile is the number of subtiles along each side of a tile. Object positions are stored in subtiles.
+const subtilesPerTile = 5
+
+// TileDiff describes which records of a tile differ between two maps
+type TileDiff struct {
+	X, Y    int
+	Floors  bool
+	Walls   bool
+	Shadows bool
+	Objects bool // The objects placed on the tile, or their paths, differ
+}
+
+// Diff compares every tile with the same tile of the other map, and returns the tiles that differ in row order. Tiles
+// whose layer counts differ are reported as changed in that layer. An error is returned if the maps have different
+// dimensions.
+func (v *DS1) Diff(other *DS1) ([]TileDiff, error) {
+	if v.Width != other.Width || v.Height != other.Height {
+		return nil, fmt.Errorf("ds1 dimensions differ, %dx%d versus %dx%d", v.Width, v.Height, other.Width, other.Height)
+	}
+	objects, otherObjects := v.objectsByTile(), other.objectsByTile()
+	var result []TileDiff
+	for y := range v.Tiles {
+		for x := range v.Tiles[y] {
+			tile, otherTile := v.Tiles[y][x], other.Tiles[y][x]
+			position := [2]int{x, y}
+			diff := TileDiff{
+				X:       x,
+				Y:       y,
+				Floors:  !equalFloorShadows(tile.Floors, otherTile.Floors),
+				Walls:   !equalWalls(tile.Walls, otherTile.Walls),
+				Shadows: !equalFloorShadows(tile.Shadows, otherTile.Shadows),
+				Objects: !equalObjects(objects[position], otherObjects[position]),
+			}
+			if diff.Floors || diff.Walls || diff.Shadows || diff.Objects {
+				result = append(result, diff)
+			}
+		}
+	}
+	return result, nil
+}
+
+// objectsByTile groups the objects by the tile they are placed on
+func (v *DS1) objectsByTile() map[[2]int][]d2data.Object {
+	result := make(map[[2]int][]d2data.Object)
+	for _, object := range v.Objects {
+		position := [2]int{int(object.X) / subtilesPerTile, int(object.Y) / subtilesPerTile}
+		result[position] = append(result[position], object)
+	}
+	return result
+}
+
+func equalFloorShadows(a, b []FloorShadowRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalWalls(a, b []WallRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equalObjects compares the objects by their stored fields, ignoring the records looked up for them
+func equalObjects(a, b []d2data.Object) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || a[i].Id != b[i].Id || a[i].X != b[i].X || a[i].Y != b[i].Y ||
+			a[i].Flags != b[i].Flags || len(a[i].Paths) != len(b[i].Paths) {
+			return false
+		}
+		for j := range a[i].Paths {
+			if a[i].Paths[j] != b[i].Paths[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
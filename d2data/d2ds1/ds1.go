@@ -1,6 +1,11 @@
 package d2ds1
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
 	"github.com/OpenDiablo2/D2Shared/d2common"
 	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
 	"github.com/OpenDiablo2/D2Shared/d2common/d2interface"
@@ -26,83 +31,111 @@ type DS1 struct {
 	SubstitutionGroups         []SubstitutionGroup
 }
 
+const (
+	minSupportedVersion = 1
+	maxSupportedVersion = 18
+	maxWallLayers       = 4
+	maxFloorLayers      = 2
+)
+
+// ParseOptions configures how a DS1 file is parsed
+type ParseOptions struct {
+	// Tolerant clamps layer counts that are out of range for the file version instead of rejecting the file, and
+	// keeps objects that are not in the lookup table of the act with a nil Lookup. Each adjustment is reported as a
+	// warning.
+	Tolerant bool
+}
+
+// SupportedVersions returns the DS1 versions the parser can read
+func SupportedVersions() []int {
+	result := make([]int, 0, maxSupportedVersion-minSupportedVersion+1)
+	for version := minSupportedVersion; version <= maxSupportedVersion; version++ {
+		result = append(result, version)
+	}
+	return result
+}
+
+// NewDS1 creates an empty map of the given size and version, with one wall, floor and shadow layer of zeroed records and
+// no objects. Version 10 and later maps get the substitution type 0, so they have no substitution layer.
+func NewDS1(width, height, version int) *DS1 {
+	result := &DS1{
+		Version:              int32(version),
+		Width:                int32(width),
+		Height:               int32(height),
+		Act:                  1,
+		Files:                make([]string, 0),
+		NumberOfWalls:        1,
+		NumberOfFloors:       1,
+		NumberOfShadowLayers: 1,
+		Objects:              make([]d2data.Object, 0),
+		SubstitutionGroups:   make([]SubstitutionGroup, 0),
+	}
+	if version < 4 {
+		result.NumberOfSubstitutionLayers = 1
+	}
+	result.resizeTiles()
+	return result
+}
+
+// LoadDS1 loads a DS1 file. It panics if the file is not a DS1 version the parser supports.
 func LoadDS1(path string, fileProvider d2interface.FileProvider) DS1 {
+	ds1, err := ParseDS1(fileProvider.LoadFile(path))
+	if err != nil {
+		log.Panicf("Could not load %s: %v", path, err)
+	}
+	return ds1
+}
+
+// LoadDS1WithOptions loads a DS1 file using the given options, and returns the warnings raised while parsing it. It
+// panics if the file can not be parsed.
+func LoadDS1WithOptions(path string, fileProvider d2interface.FileProvider, options ParseOptions) (DS1, []string) {
+	ds1, warnings, err := ParseDS1WithOptions(fileProvider.LoadFile(path), options)
+	if err != nil {
+		log.Panicf("Could not load %s: %v", path, err)
+	}
+	return ds1, warnings
+}
+
+// ParseDS1 parses the content of a DS1 file, returning an error if the version is not supported, the layer counts
+// are out of range or an object is not in the lookup table of the act
+func ParseDS1(fileData []byte) (DS1, error) {
+	ds1, _, err := ParseDS1WithOptions(fileData, ParseOptions{})
+	return ds1, err
+}
+
+// ParseDS1WithOptions parses the content of a DS1 file using the given options, and returns the warnings raised while
+// parsing it
+func ParseDS1WithOptions(fileData []byte, options ParseOptions) (DS1, []string, error) {
 	ds1 := DS1{
 		NumberOfFloors:             1,
 		NumberOfWalls:              1,
 		NumberOfShadowLayers:       1,
 		NumberOfSubstitutionLayers: 0,
 	}
-	fileData := fileProvider.LoadFile(path)
 	br := d2common.CreateStreamReader(fileData)
-	ds1.Version = br.GetInt32()
-	ds1.Width = br.GetInt32() + 1
-	ds1.Height = br.GetInt32() + 1
-	if ds1.Version >= 8 {
-		ds1.Act = d2helper.MinInt32(5, br.GetInt32()+1)
+	var err error
+	if ds1.Version, err = br.ReadInt32(); err != nil {
+		return DS1{}, nil, fmt.Errorf("ds1 data is too short (%d bytes)", len(fileData))
 	}
-	if ds1.Version >= 10 {
-		ds1.SubstitutionType = br.GetInt32()
-		if ds1.SubstitutionType == 1 || ds1.SubstitutionType == 2 {
-			ds1.NumberOfSubstitutionLayers = 1
-		}
+	if ds1.Version < minSupportedVersion || ds1.Version > maxSupportedVersion {
+		return DS1{}, nil, fmt.Errorf("ds1 version %d is not supported, expected a version from %d to %d",
+			ds1.Version, minSupportedVersion, maxSupportedVersion)
 	}
-	if ds1.Version >= 3 {
-		// These files reference things that don't exist anymore :-?
-		numberOfFiles := br.GetInt32()
-		ds1.Files = make([]string, numberOfFiles)
-		for i := 0; i < int(numberOfFiles); i++ {
-			ds1.Files[i] = ""
-			for {
-				ch := br.GetByte()
-				if ch == 0 {
-					break
-				}
-				ds1.Files[i] += string(ch)
-			}
-		}
+	if err := ds1.readHeader(br); err != nil {
+		return DS1{}, nil, fmt.Errorf("ds1 header is truncated: %v", err)
 	}
-	if ds1.Version >= 9 && ds1.Version <= 13 {
-		// Skipping two dwords because they are "meaningless"?
-		br.SkipBytes(16)
+	warnings, err := ds1.reconcileLayerCounts(options.Tolerant)
+	if err != nil {
+		return DS1{}, nil, err
 	}
-	if ds1.Version >= 4 {
-		ds1.NumberOfWalls = br.GetInt32()
-		if ds1.Version >= 16 {
-			ds1.NumberOfFloors = br.GetInt32()
-		} else {
-			ds1.NumberOfFloors = 1
-		}
+	if ds1.Width <= 0 || ds1.Height <= 0 {
+		return DS1{}, nil, fmt.Errorf("ds1 size %dx%d is invalid", ds1.Width, ds1.Height)
 	}
-	var layerStream []d2enum.LayerStreamType
-	if ds1.Version < 4 {
-		layerStream = []d2enum.LayerStreamType{
-			d2enum.LayerStreamWall1,
-			d2enum.LayerStreamFloor1,
-			d2enum.LayerStreamOrientation1,
-			d2enum.LayerStreamSubstitute,
-			d2enum.LayerStreamShadow,
-		}
-	} else {
-		layerStream = make([]d2enum.LayerStreamType, (ds1.NumberOfWalls*2)+ds1.NumberOfFloors+ds1.NumberOfShadowLayers+ds1.NumberOfSubstitutionLayers)
-		layerIdx := 0
-		for i := 0; i < int(ds1.NumberOfWalls); i++ {
-			layerStream[layerIdx] = d2enum.LayerStreamType(int(d2enum.LayerStreamWall1) + i)
-			layerStream[layerIdx+1] = d2enum.LayerStreamType(int(d2enum.LayerStreamOrientation1) + i)
-			layerIdx += 2
-		}
-		for i := 0; i < int(ds1.NumberOfFloors); i++ {
-			layerStream[layerIdx] = d2enum.LayerStreamType(int(d2enum.LayerStreamFloor1) + i)
-			layerIdx++
-		}
-		if ds1.NumberOfShadowLayers > 0 {
-			layerStream[layerIdx] = d2enum.LayerStreamShadow
-			layerIdx++
-		}
-		if ds1.NumberOfSubstitutionLayers > 0 {
-			layerStream[layerIdx] = d2enum.LayerStreamSubstitute
-			layerIdx++
-		}
+	layerStream := ds1.layerStreams()
+	layerData := uint64(ds1.Width) * uint64(ds1.Height) * uint64(len(layerStream)) * 4
+	if layerData > br.GetSize()-br.GetPosition() {
+		return DS1{}, nil, fmt.Errorf("ds1 layer data is truncated, %d bytes are needed for a %dx%d map",
+			layerData, ds1.Width, ds1.Height)
 	}
 	ds1.Tiles = make([][]TileRecord, ds1.Height)
 	for y := range ds1.Tiles {
@@ -117,7 +150,10 @@ func LoadDS1(path string, fileProvider d2interface.FileProvider) DS1 {
 	for _, layerStreamType := range layerStream {
 		for y := 0; y < int(ds1.Height); y++ {
 			for x := 0; x < int(ds1.Width); x++ {
-				dw := br.GetUInt32()
+				dw, err := br.ReadUInt32()
+				if err != nil {
+					return DS1{}, nil, fmt.Errorf("ds1 layer data is truncated at tile (%d, %d)", x, y)
+				}
 				switch layerStreamType {
 				case d2enum.LayerStreamWall1:
 					fallthrough
@@ -172,78 +208,348 @@ func LoadDS1(path string, fileProvider d2interface.FileProvider) DS1 {
 			}
 		}
 	}
-	if ds1.Version >= 2 {
-		numberOfObjects := br.GetInt32()
-		ds1.Objects = make([]d2data.Object, numberOfObjects)
-		for objIdx := 0; objIdx < int(numberOfObjects); objIdx++ {
-			newObject := d2data.Object{}
-			newObject.Type = br.GetInt32()
-			newObject.Id = br.GetInt32()
-			newObject.X = br.GetInt32()
-			newObject.Y = br.GetInt32()
-			newObject.Flags = br.GetInt32()
-			newObject.Lookup = d2datadict.LookupObject(int(ds1.Act), int(newObject.Type), int(newObject.Id))
-			if newObject.Lookup != nil && newObject.Lookup.ObjectsTxtId != -1 {
-				newObject.ObjectInfo = d2datadict.Objects[newObject.Lookup.ObjectsTxtId]
-			}
-			ds1.Objects[objIdx] = newObject
+	objectWarnings, err := ds1.readObjects(br, options.Tolerant)
+	if err != nil {
+		return DS1{}, nil, err
+	}
+	warnings = append(warnings, objectWarnings...)
+	if err := ds1.readSubstitutionGroups(br); err != nil {
+		return DS1{}, nil, fmt.Errorf("ds1 substitution groups are truncated: %v", err)
+	}
+	if err := ds1.readNpcPaths(br); err != nil {
+		return DS1{}, nil, fmt.Errorf("ds1 npc paths are truncated: %v", err)
+	}
+	return ds1, warnings, nil
+}
+
+// readHeader reads the fields between the version and the tile layers
+func (v *DS1) readHeader(br *d2common.StreamReader) error {
+	if err := readInt32s(br, &v.Width, &v.Height); err != nil {
+		return err
+	}
+	v.Width++
+	v.Height++
+	if v.Version < 4 {
+		// Files before version 4 always store a substitution layer
+		v.NumberOfSubstitutionLayers = 1
+	}
+	if v.Version >= 8 {
+		var act int32
+		if err := readInt32s(br, &act); err != nil {
+			return err
 		}
-	} else {
-		ds1.Objects = make([]d2data.Object, 0)
+		v.Act = d2helper.MinInt32(5, act+1)
 	}
-	if ds1.Version >= 12 && (ds1.SubstitutionType == 1 || ds1.SubstitutionType == 2) {
-		if ds1.Version >= 18 {
-			br.GetUInt32()
+	if v.Version >= 10 {
+		if err := readInt32s(br, &v.SubstitutionType); err != nil {
+			return err
 		}
-		numberOfSubGroups := br.GetInt32()
-		ds1.SubstitutionGroups = make([]SubstitutionGroup, numberOfSubGroups)
-		for subIdx := 0; subIdx < int(numberOfSubGroups); subIdx++ {
-			newSub := SubstitutionGroup{}
-			newSub.TileX = br.GetInt32()
-			newSub.TileY = br.GetInt32()
-			newSub.WidthInTiles = br.GetInt32()
-			newSub.HeightInTiles = br.GetInt32()
-			newSub.Unknown = br.GetInt32()
-
-			ds1.SubstitutionGroups[subIdx] = newSub
+		if v.SubstitutionType == 1 || v.SubstitutionType == 2 {
+			v.NumberOfSubstitutionLayers = 1
 		}
-	} else {
-		ds1.SubstitutionGroups = make([]SubstitutionGroup, 0)
-	}
-	if ds1.Version >= 14 {
-		numberOfNpcs := br.GetInt32()
-		for npcIdx := 0; npcIdx < int(numberOfNpcs); npcIdx++ {
-			numPaths := br.GetInt32()
-			npcX := br.GetInt32()
-			npcY := br.GetInt32()
-			objIdx := -1
-			for idx, ds1Obj := range ds1.Objects {
-				if ds1Obj.X == npcX && ds1Obj.Y == npcY {
-					objIdx = idx
+	}
+	if v.Version >= 3 {
+		// These files reference things that don't exist anymore :-?
+		var numberOfFiles int32
+		if err := readInt32s(br, &numberOfFiles); err != nil {
+			return err
+		}
+		// Every name takes at least its terminating zero
+		if err := checkRecords(br, numberOfFiles, 1); err != nil {
+			return err
+		}
+		v.Files = make([]string, numberOfFiles)
+		for i := range v.Files {
+			var name []byte
+			for {
+				ch, err := br.ReadByte()
+				if err != nil {
+					return io.ErrUnexpectedEOF
+				}
+				if ch == 0 {
 					break
 				}
+				name = append(name, ch)
+			}
+			v.Files[i] = string(name)
+		}
+	}
+	if v.Version >= 9 && v.Version <= 13 {
+		// Skipping two dwords because they are "meaningless"?
+		if err := skipBytes(br, 16); err != nil {
+			return err
+		}
+	}
+	if v.Version >= 4 {
+		if err := readInt32s(br, &v.NumberOfWalls); err != nil {
+			return err
+		}
+		v.NumberOfFloors = 1
+		if v.Version >= 16 {
+			if err := readInt32s(br, &v.NumberOfFloors); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readObjects reads the objects placed in the map. An object whose type and id are not in the lookup table of the act
+// is an error, unless tolerant is set, in which case its Lookup is left nil and a warning is returned.
+func (v *DS1) readObjects(br *d2common.StreamReader, tolerant bool) ([]string, error) {
+	v.Objects = make([]d2data.Object, 0)
+	if v.Version < 2 {
+		return nil, nil
+	}
+	var numberOfObjects int32
+	if err := readInt32s(br, &numberOfObjects); err != nil {
+		return nil, fmt.Errorf("ds1 objects are truncated: %v", err)
+	}
+	if err := checkRecords(br, numberOfObjects, 20); err != nil {
+		return nil, fmt.Errorf("ds1 objects are truncated: %v", err)
+	}
+	var warnings []string
+	v.Objects = make([]d2data.Object, numberOfObjects)
+	for objIdx := range v.Objects {
+		newObject := d2data.Object{}
+		err := readInt32s(br, &newObject.Type, &newObject.Id, &newObject.X, &newObject.Y, &newObject.Flags)
+		if err != nil {
+			return nil, fmt.Errorf("ds1 objects are truncated: %v", err)
+		}
+		newObject.Lookup = d2datadict.FindObjectLookup(int(v.Act), int(newObject.Type), int(newObject.Id))
+		if newObject.Lookup == nil {
+			message := fmt.Sprintf("ds1 object %d has type %d and id %d, which act %d does not define",
+				objIdx, newObject.Type, newObject.Id, v.Act)
+			if !tolerant {
+				return nil, errors.New(message)
+			}
+			warnings = append(warnings, message)
+		} else if newObject.Lookup.ObjectsTxtId != -1 {
+			newObject.ObjectInfo = d2datadict.Objects[newObject.Lookup.ObjectsTxtId]
+		}
+		v.Objects[objIdx] = newObject
+	}
+	return warnings, nil
+}
+
+// readSubstitutionGroups reads the substitution groups, which only maps with a substitution layer have
+func (v *DS1) readSubstitutionGroups(br *d2common.StreamReader) error {
+	v.SubstitutionGroups = make([]SubstitutionGroup, 0)
+	if v.Version < 12 || (v.SubstitutionType != 1 && v.SubstitutionType != 2) {
+		return nil
+	}
+	if v.Version >= 18 {
+		if _, err := br.ReadUInt32(); err != nil {
+			return err
+		}
+	}
+	var numberOfSubGroups int32
+	if err := readInt32s(br, &numberOfSubGroups); err != nil {
+		return err
+	}
+	if err := checkRecords(br, numberOfSubGroups, 20); err != nil {
+		return err
+	}
+	v.SubstitutionGroups = make([]SubstitutionGroup, numberOfSubGroups)
+	for subIdx := range v.SubstitutionGroups {
+		newSub := &v.SubstitutionGroups[subIdx]
+		err := readInt32s(br, &newSub.TileX, &newSub.TileY, &newSub.WidthInTiles, &newSub.HeightInTiles, &newSub.Unknown)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readNpcPaths reads the paths of the NPCs, and attaches each to the object at the position of the NPC
+func (v *DS1) readNpcPaths(br *d2common.StreamReader) error {
+	if v.Version < 14 {
+		return nil
+	}
+	var numberOfNpcs int32
+	if err := readInt32s(br, &numberOfNpcs); err != nil {
+		return err
+	}
+	if err := checkRecords(br, numberOfNpcs, 12); err != nil {
+		return err
+	}
+	pointSize := 8
+	if v.Version >= 15 {
+		pointSize = 12
+	}
+	for npcIdx := 0; npcIdx < int(numberOfNpcs); npcIdx++ {
+		var numPaths, npcX, npcY int32
+		if err := readInt32s(br, &numPaths, &npcX, &npcY); err != nil {
+			return err
+		}
+		if err := checkRecords(br, numPaths, pointSize); err != nil {
+			return err
+		}
+		objIdx := -1
+		for idx, ds1Obj := range v.Objects {
+			if ds1Obj.X == npcX && ds1Obj.Y == npcY {
+				objIdx = idx
+				break
 			}
-			if objIdx > -1 {
-				if ds1.Objects[objIdx].Paths == nil {
-					ds1.Objects[objIdx].Paths = make([]d2common.Path, numPaths)
+		}
+		if objIdx > -1 {
+			// When several records are at the position of the same object, the last one is its path
+			v.Objects[objIdx].Paths = make([]d2common.Path, numPaths)
+			for pathIdx := 0; pathIdx < int(numPaths); pathIdx++ {
+				newPath := d2common.Path{}
+				if err := readInt32s(br, &newPath.X, &newPath.Y); err != nil {
+					return err
 				}
-				for pathIdx := 0; pathIdx < int(numPaths); pathIdx++ {
-					newPath := d2common.Path{}
-					newPath.X = br.GetInt32()
-					newPath.Y = br.GetInt32()
-					if ds1.Version >= 15 {
-						newPath.Action = br.GetInt32()
+				if v.Version >= 15 {
+					if err := readInt32s(br, &newPath.Action); err != nil {
+						return err
 					}
-					ds1.Objects[objIdx].Paths[pathIdx] = newPath
 				}
-			} else {
-				if ds1.Version >= 15 {
-					br.SkipBytes(int(numPaths) * 3)
-				} else {
-					br.SkipBytes(int(numPaths) * 2)
+				v.Objects[objIdx].Paths[pathIdx] = newPath
+			}
+		} else {
+			br.SkipBytes(int(numPaths) * pointSize)
+		}
+	}
+	return nil
+}
+
+// readInt32s reads consecutive dwords into the values, stopping at the first that can not be read
+func readInt32s(br *d2common.StreamReader, values ...*int32) error {
+	for _, value := range values {
+		read, err := br.ReadInt32()
+		if err != nil {
+			return err
+		}
+		*value = read
+	}
+	return nil
+}
+
+// checkRecords returns an error if the count is negative, or the rest of the data is too short to hold that many
+// records of the given size, so corrupt counts fail before anything is allocated for them
+func checkRecords(br *d2common.StreamReader, count int32, recordSize int) error {
+	if count < 0 {
+		return fmt.Errorf("negative count %d", count)
+	}
+	if uint64(count)*uint64(recordSize) > br.GetSize()-br.GetPosition() {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// skipBytes skips count bytes, or returns io.ErrUnexpectedEOF if fewer remain
+func skipBytes(br *d2common.StreamReader, count int) error {
+	if uint64(count) > br.GetSize()-br.GetPosition() {
+		return io.ErrUnexpectedEOF
+	}
+	br.SkipBytes(count)
+	return nil
+}
+
+// layerStreams returns the order in which the layers of the tiles are stored in the file
+func (v *DS1) layerStreams() []d2enum.LayerStreamType {
+	var layerStream []d2enum.LayerStreamType
+	if v.Version < 4 {
+		layerStream = []d2enum.LayerStreamType{
+			d2enum.LayerStreamWall1,
+			d2enum.LayerStreamFloor1,
+			d2enum.LayerStreamOrientation1,
+			d2enum.LayerStreamSubstitute,
+			d2enum.LayerStreamShadow,
+		}
+	} else {
+		layerStream = make([]d2enum.LayerStreamType, (v.NumberOfWalls*2)+v.NumberOfFloors+v.NumberOfShadowLayers+v.NumberOfSubstitutionLayers)
+		layerIdx := 0
+		for i := 0; i < int(v.NumberOfWalls); i++ {
+			layerStream[layerIdx] = d2enum.LayerStreamType(int(d2enum.LayerStreamWall1) + i)
+			layerStream[layerIdx+1] = d2enum.LayerStreamType(int(d2enum.LayerStreamOrientation1) + i)
+			layerIdx += 2
+		}
+		for i := 0; i < int(v.NumberOfFloors); i++ {
+			layerStream[layerIdx] = d2enum.LayerStreamType(int(d2enum.LayerStreamFloor1) + i)
+			layerIdx++
+		}
+		if v.NumberOfShadowLayers > 0 {
+			layerStream[layerIdx] = d2enum.LayerStreamShadow
+			layerIdx++
+		}
+		if v.NumberOfSubstitutionLayers > 0 {
+			layerStream[layerIdx] = d2enum.LayerStreamSubstitute
+			layerIdx++
+		}
+	}
+	return layerStream
+}
+
+// reconcileLayerCounts checks the wall and floor layer counts against the maximum for the file version. Counts that
+// are out of range are an error, unless tolerant is set, in which case they are clamped and a warning is returned.
+func (v *DS1) reconcileLayerCounts(tolerant bool) ([]string, error) {
+	maxFloors := int32(1)
+	if v.Version >= 16 {
+		maxFloors = maxFloorLayers
+	}
+	var warnings []string
+	clamp := func(name string, count *int32, max int32) error {
+		if *count >= 0 && *count <= max {
+			return nil
+		}
+		message := fmt.Sprintf("ds1 version %d declares %d %s layers, expected 0 to %d", v.Version, *count, name, max)
+		if !tolerant {
+			return errors.New(message)
+		}
+		*count = d2helper.MaxInt32(0, d2helper.MinInt32(max, *count))
+		warnings = append(warnings, fmt.Sprintf("%s, using %d", message, *count))
+		return nil
+	}
+	if err := clamp("wall", &v.NumberOfWalls, maxWallLayers); err != nil {
+		return nil, err
+	}
+	if err := clamp("floor", &v.NumberOfFloors, maxFloors); err != nil {
+		return nil, err
+	}
+	return warnings, nil
+}
+
+// TileAt returns the floor, wall, shadow and substitution records of the tile at the given coordinates. The map size
+// is given by the Width and Height fields.
+func (v *DS1) TileAt(x, y int) (*TileRecord, error) {
+	if !v.inBounds(x, y) {
+		return nil, fmt.Errorf("tile (%d, %d) is outside of the %dx%d map", x, y, v.Width, v.Height)
+	}
+	return &v.Tiles[y][x], nil
+}
+
+func (v *DS1) inBounds(x, y int) bool {
+	return x >= 0 && y >= 0 && x < int(v.Width) && y < int(v.Height)
+}
+
+// TaggedTiles returns the [x, y] coordinates of the tiles that are tagged. Files without a tag layer have none.
+func (v *DS1) TaggedTiles() [][2]int {
+	var result [][2]int
+	for y := range v.Tiles {
+		for x := range v.Tiles[y] {
+			for _, substitution := range v.Tiles[y][x].Substitutions {
+				if substitution.Tagged() {
+					result = append(result, [2]int{x, y})
+					break
 				}
 			}
 		}
 	}
-	return ds1
+	return result
+}
+
+// VisibleWalls returns the walls at the given tile that should be drawn
+func (v *DS1) VisibleWalls(x, y int) []WallRecord {
+	if !v.inBounds(x, y) {
+		return nil
+	}
+	result := make([]WallRecord, 0, len(v.Tiles[y][x].Walls))
+	for _, wall := range v.Tiles[y][x].Walls {
+		if wall.Visible() {
+			result = append(result, wall)
+		}
+	}
+	return result
 }
@@ -0,0 +1,534 @@
+package d2ds1
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/OpenDiablo2/D2Shared/d2common"
+	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+	"github.com/OpenDiablo2/D2Shared/d2data"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2dt1"
+)
+
+// encodeTestDS1 encodes a 1x1 version 16 map that declares the wall count but only holds data for layers up to
+// the maximum
+func encodeTestDS1(declaredWalls uint32) []byte {
+	sw := d2common.CreateStreamWriter()
+	sw.PushUint32(16) // Version
+	sw.PushUint32(0)  // Width - 1
+	sw.PushUint32(0)  // Height - 1
+	sw.PushUint32(0)  // Act - 1
+	sw.PushUint32(0)  // Substitution type
+	sw.PushUint32(0)  // Number of files
+	sw.PushUint32(declaredWalls)
+	sw.PushUint32(1) // Number of floors
+	for i := 0; i < (maxWallLayers*2)+2; i++ {
+		sw.PushUint32(0)
+	}
+	sw.PushUint32(0) // Number of objects
+	sw.PushUint32(0) // Number of NPCs
+	return sw.GetBytes()
+}
+
+func TestParseLayerCounts(t *testing.T) {
+	if _, err := ParseDS1(encodeTestDS1(5)); err == nil {
+		t.Fatal("Expected an error for a wall count above the maximum in strict mode")
+	}
+	ds1, warnings, err := ParseDS1WithOptions(encodeTestDS1(5), ParseOptions{Tolerant: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds1.NumberOfWalls != maxWallLayers || len(ds1.Tiles[0][0].Walls) != maxWallLayers {
+		t.Fatalf("Expected the wall count to be clamped to %d, got %d", maxWallLayers, ds1.NumberOfWalls)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("Expected one warning but got %v", warnings)
+	}
+	if _, warnings, err = ParseDS1WithOptions(encodeTestDS1(maxWallLayers), ParseOptions{Tolerant: true}); err != nil ||
+		len(warnings) != 0 {
+		t.Fatalf("Expected a valid file to parse without warnings, got %v (%v)", warnings, err)
+	}
+}
+
+func TestRenderDS1(t *testing.T) {
+	floorData := make([]byte, 256)
+	for i := range floorData {
+		floorData[i] = 5
+	}
+	dt1 := &d2dt1.DT1{Tiles: []d2dt1.Tile{
+		{
+			Orientation: int32(d2enum.Floors),
+			Blocks:      []d2dt1.Block{{Format: d2dt1.BlockFormatIsometric, EncodedData: floorData}},
+		},
+		{
+			Orientation: int32(d2enum.LeftWall),
+			Blocks:      []d2dt1.Block{{Format: d2dt1.BlockFormatRLE, EncodedData: []byte{14, 4, 9, 9, 9, 9, 0, 0}}},
+		},
+	}}
+	ds1, err := ParseDS1(encodeTestDS1(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds1.Tiles[0][0].Floors[0] = FloorShadowRecord{Prop1: 1}
+	ds1.Tiles[0][0].Walls[0] = WallRecord{Prop1: 1, Orientation: byte(d2enum.LeftWall)}
+	palette := d2datadict.PaletteRec{}
+	palette.Colors[5] = d2datadict.PaletteRGB{R: 50}
+	palette.Colors[9] = d2datadict.PaletteRGB{R: 90}
+	img, err := RenderDS1(&ds1, []*d2dt1.DT1{dt1}, palette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.RGBAAt(14, 0).R != 90 {
+		t.Fatalf("Expected the wall to be drawn over the floor, got %v", img.RGBAAt(14, 0))
+	}
+	if img.RGBAAt(16, 7).R != 50 {
+		t.Fatalf("Expected the floor to be drawn, got %v", img.RGBAAt(16, 7))
+	}
+	if img.RGBAAt(0, 0).A != 0 {
+		t.Fatal("Expected pixels outside of the tiles to be transparent")
+	}
+}
+
+func TestStamp(t *testing.T) {
+	target, err := ParseDS1(encodeTestDS1(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	piece, err := ParseDS1(encodeTestDS1(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	piece.Tiles[0][0].Floors[0] = FloorShadowRecord{Prop1: 1, MainIndex: 7}
+	piece.Tiles[0][0].Walls[1] = WallRecord{Prop1: 1, MainIndex: 3}
+	if err := target.Stamp(&piece, 1, 0); err == nil {
+		t.Fatal("Expected an error when the stamped map does not fit")
+	}
+	if err := target.StampWithOptions(&piece, 1, 2, StampOptions{Grow: true}); err != nil {
+		t.Fatal(err)
+	}
+	if target.Width != 2 || target.Height != 3 || len(target.Tiles) != 3 || len(target.Tiles[0]) != 2 {
+		t.Fatalf("Expected the map to grow to 2x3, got %dx%d", target.Width, target.Height)
+	}
+	tile := target.Tiles[2][1]
+	if target.NumberOfWalls != 2 || len(tile.Walls) != 2 || len(target.Tiles[0][0].Walls) != 2 {
+		t.Fatal("Expected the wall layer of the stamped map to be added")
+	}
+	if tile.Floors[0].MainIndex != 7 || tile.Walls[1].MainIndex != 3 {
+		t.Fatalf("Expected the stamped records to be copied, got %+v", tile)
+	}
+}
+
+func TestWarps(t *testing.T) {
+	vis := [8]int{0, 0, 3, 0, 0, 0, 0, 0}
+	ds1, err := ParseDS1(encodeTestDS1(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warps := ds1.Warps(vis); warps == nil || len(warps) != 0 {
+		t.Fatalf("Expected an empty slice for a map without warps, got %v", warps)
+	}
+	for _, version := range []int{6, 7, 18} {
+		ds1 := NewDS1(2, 1, version)
+		ds1.Tiles[0][1].Walls[0] = WallRecord{Orientation: byte(d2enum.SpecialTile1), MainIndex: warpMainIndex, SubIndex: 2}
+		data, err := ds1.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseDS1(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		warps := parsed.Warps(vis)
+		if version < minWarpVersion {
+			if warps == nil || len(warps) != 0 {
+				t.Fatalf("Expected an empty slice for version %d, got %v", version, warps)
+			}
+			continue
+		}
+		if len(warps) != 1 || warps[0] != (WarpRecord{X: 1, Y: 0, Index: 2, TargetLevelId: 3}) {
+			t.Fatalf("Expected a warp to level 3 at (1, 0) for version %d, got %v", version, warps)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, err := ParseDS1(encodeTestDS1(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ParseDS1(encodeTestDS1(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffs, err := a.Diff(&b); err != nil || len(diffs) != 0 {
+		t.Fatalf("Expected identical maps not to differ, got %v (%v)", diffs, err)
+	}
+	b.Tiles[0][0].Floors[0].MainIndex = 4
+	b.Objects = append(b.Objects, d2data.Object{Type: 1, Id: 2, X: 2, Y: 3})
+	diffs, err := a.Diff(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := TileDiff{Floors: true, Objects: true}
+	if len(diffs) != 1 || diffs[0] != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, diffs)
+	}
+	b.Width = 2
+	if _, err := a.Diff(&b); err == nil {
+		t.Fatal("Expected an error for maps of different dimensions")
+	}
+}
+
+func TestNewDS1Marshal(t *testing.T) {
+	ds1 := NewDS1(3, 2, 18)
+	if len(ds1.Tiles) != 2 || len(ds1.Tiles[0]) != 3 || len(ds1.Tiles[1][2].Walls) != 1 {
+		t.Fatal("Expected the tiles of the new map to be allocated")
+	}
+	ds1.Tiles[1][2].Walls[0] = WallRecord{Orientation: 3, Prop1: 1, SubIndex: 2, MainIndex: 5, Hidden: true}
+	ds1.Tiles[0][1].Floors[0] = FloorShadowRecord{Prop1: 1, MainIndex: 7, Unknown2: 3}
+	ds1.Objects = append(ds1.Objects, d2data.Object{Type: int32(d2datadict.ObjectTypeCharacter), X: 4, Y: 6,
+		Paths: []d2common.Path{{X: 5, Y: 6, Action: 1}}})
+	data, err := ds1.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseDS1(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := ds1.Diff(&parsed)
+	if err != nil || len(diffs) != 0 {
+		t.Fatalf("Expected the marshaled map to parse into the same map, got %+v (%v)", diffs, err)
+	}
+	if parsed.Version != 18 || parsed.Act != 1 || parsed.NumberOfWalls != 1 || parsed.NumberOfFloors != 1 {
+		t.Fatalf("Expected the header to be kept, got %+v", parsed)
+	}
+}
+
+func TestMarshalEarlyVersions(t *testing.T) {
+	for version := 1; version < 4; version++ {
+		ds1 := NewDS1(2, 1, version)
+		ds1.Tiles[0][1].Walls[0] = WallRecord{Orientation: 1, Prop1: 1, MainIndex: 3}
+		ds1.Tiles[0][0].Substitutions[0].Unknown = 7
+		data, err := ds1.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseDS1(data)
+		if err != nil {
+			t.Fatalf("Expected version %d to parse, got %v", version, err)
+		}
+		diffs, err := ds1.Diff(&parsed)
+		if err != nil || len(diffs) != 0 {
+			t.Fatalf("Expected version %d to parse into the same map, got %+v (%v)", version, diffs, err)
+		}
+		if parsed.Tiles[0][0].Substitutions[0].Unknown != 7 {
+			t.Fatalf("Expected the substitution layer of version %d to be kept", version)
+		}
+	}
+}
+
+func TestParseTruncatedLayers(t *testing.T) {
+	data := encodeTestDS1(1)
+	if _, err := ParseDS1(data[:40]); err == nil {
+		t.Fatal("Expected an error for truncated layer data")
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	ds1 := NewDS1(2, 1, 18)
+	ds1.Files = []string{`data\global\tiles\act1\town\floor.tg1`}
+	ds1.Objects = append(ds1.Objects, d2data.Object{
+		Type:  int32(d2datadict.ObjectTypeCharacter),
+		Id:    2,
+		X:     3,
+		Y:     4,
+		Paths: []d2common.Path{{X: 5, Y: 6, Action: 1}},
+	})
+	data, err := ds1.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseDS1(data); err != nil {
+		t.Fatal(err)
+	}
+	// 10 bytes ends inside the height, and 30 inside the name of the file
+	for _, length := range []int{10, 30} {
+		if _, err := ParseDS1(data[:length]); err == nil || !strings.Contains(err.Error(), "header") {
+			t.Fatalf("Expected a truncated header error for %d bytes, got %v", length, err)
+		}
+	}
+	// The object record is followed by the NPC count and a path of 3 dwords
+	objectEnd := len(data) - 4 - 12 - 12
+	if _, err := ParseDS1(data[:objectEnd-8]); err == nil || !strings.Contains(err.Error(), "objects") {
+		t.Fatalf("Expected a truncated objects error, got %v", err)
+	}
+	for length := 0; length < len(data); length++ {
+		if _, err := ParseDS1(data[:length]); err == nil {
+			t.Fatalf("Expected an error for the first %d bytes of the map", length)
+		}
+	}
+}
+
+func TestParseNpcPaths(t *testing.T) {
+	ds1 := NewDS1(1, 1, 18)
+	ds1.Objects = append(ds1.Objects, d2data.Object{Type: int32(d2datadict.ObjectTypeCharacter), Id: 2, X: 3, Y: 4})
+	data, err := ds1.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw := d2common.CreateStreamWriter()
+	for _, value := range []uint32{
+		3,                           // Number of NPCs
+		2, 99, 99, 1, 1, 1, 2, 2, 2, // A path at no object's position
+		1, 3, 4, 5, 6, 7, // A path of the object
+		2, 3, 4, 8, 9, 10, 11, 12, 13, // A longer path of the same object, which replaces the first
+	} {
+		sw.PushUint32(value)
+	}
+	// Replace the NPC count of 0 at the end of the map with the records
+	data = append(data[:len(data)-4], sw.GetBytes()...)
+	parsed, err := ParseDS1(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := parsed.ObjectPath(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PathPoint{{X: 8, Y: 9, Action: 10}, {X: 11, Y: 12, Action: 13}}
+	if len(path) != len(expected) || path[0] != expected[0] || path[1] != expected[1] {
+		t.Fatalf("Expected the path %v, got %v", expected, path)
+	}
+}
+
+func TestPathActions(t *testing.T) {
+	for _, version := range []int{14, 18} {
+		ds1 := NewDS1(1, 1, version)
+		ds1.Objects = append(ds1.Objects, d2data.Object{
+			Type: int32(d2datadict.ObjectTypeCharacter),
+			Id:   2,
+			Paths: []d2common.Path{
+				{X: 1, Y: 1, Action: 1}, {X: 2, Y: 2, Action: 2}, {X: 3, Y: 3, Action: 3}, {X: 4, Y: 4, Action: 7},
+			},
+		})
+		data, err := ds1.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseDS1(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, err := parsed.ObjectPath(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []PathAction{PathActionWalk, PathActionRun, PathActionAttack, PathAction(7)}
+		if version < 15 {
+			expected = []PathAction{PathActionNone, PathActionNone, PathActionNone, PathActionNone}
+		}
+		if len(path) != len(expected) {
+			t.Fatalf("Expected %d points for version %d, got %d", len(expected), version, len(path))
+		}
+		for i, point := range path {
+			if point.Action != expected[i] {
+				t.Errorf("Expected the action %v at point %d for version %d, got %v", expected[i], i, version, point.Action)
+			}
+		}
+	}
+	names := map[PathAction]string{
+		PathActionNone: "None", PathActionWalk: "Walk", PathActionRun: "Run", PathActionAttack: "Attack",
+		PathAction(7): "PathAction(7)",
+	}
+	for action, name := range names {
+		if action.String() != name {
+			t.Errorf("Expected the name %q, got %q", name, action.String())
+		}
+	}
+}
+
+func TestParseUnknownObject(t *testing.T) {
+	ds1 := NewDS1(1, 1, 18)
+	ds1.Objects = append(ds1.Objects,
+		d2data.Object{Type: int32(d2datadict.ObjectTypeCharacter), Id: 2},
+		d2data.Object{Type: int32(d2datadict.ObjectTypeCharacter), Id: 9999})
+	data, err := ds1.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseDS1(data); err == nil || !strings.Contains(err.Error(), "9999") {
+		t.Fatalf("Expected an error for the unknown object, got %v", err)
+	}
+	parsed, warnings, err := ParseDS1WithOptions(data, ParseOptions{Tolerant: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.Objects) != 2 || parsed.Objects[0].Lookup == nil || parsed.Objects[1].Lookup != nil {
+		t.Fatalf("Expected only the unknown object to have no lookup, got %+v", parsed.Objects)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("Expected a warning for the unknown object, got %v", warnings)
+	}
+}
+
+func TestFloorOrientation(t *testing.T) {
+	ds1 := NewDS1(1, 1, 18)
+	ds1.Tiles[0][0].Floors[0] = FloorShadowRecord{Prop1: 1, MainIndex: 2, SubIndex: 3}
+	data, err := ds1.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseDS1(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orientation := parsed.Tiles[0][0].Floors[0].Orientation(); orientation != d2enum.Floors {
+		t.Fatalf("Expected floors to use the floor orientation, got %d", orientation)
+	}
+}
+
+func TestCollisionGrid(t *testing.T) {
+	floor := d2dt1.Tile{Orientation: int32(d2enum.Floors), MainIndex: 1}
+	floor.SubTileFlags[0] = d2dt1.SubTileBlockWalk         // Bottom left
+	floor.SubTileFlags[24] = d2dt1.SubTileBlockWalk | 0x08 // Top right
+	wall := d2dt1.Tile{Orientation: 1, MainIndex: 2}
+	wall.SubTileFlags[7] = d2dt1.SubTileBlockWalk // Fourth row, third column
+	wall.SubTileFlags[12] = 0x08                  // Centre, flags that do not block walking
+	if floor.SubTileFlagsAt(0, 4) != d2dt1.SubTileBlockWalk ||
+		floor.SubTileFlagsAt(4, 0) != d2dt1.SubTileBlockWalk|0x08 {
+		t.Fatal("Expected the sub-tile flags to be stored from the bottom row up")
+	}
+	if mask := wall.CollisionMask(); !mask[3][2] || mask[2][2] || mask[1][2] {
+		t.Fatalf("Expected only sub-tile (2, 3) of the wall to block walking, got %v", mask)
+	}
+
+	ds1 := NewDS1(2, 2, 18)
+	ds1.Tiles[0][0].Floors[0] = FloorShadowRecord{Prop1: 1, MainIndex: 1}
+	ds1.Tiles[1][1].Walls[0] = WallRecord{Orientation: 1, Prop1: 1, MainIndex: 2}
+	ds1.Tiles[1][0].Floors[0] = FloorShadowRecord{Prop1: 1, MainIndex: 1, Hidden: true}
+	ds1.Tiles[0][1].Walls[0] = WallRecord{Orientation: 1, Prop1: 1, MainIndex: 2, Hidden: true}
+	grid := ds1.CollisionGrid(&d2dt1.DT1{Tiles: []d2dt1.Tile{floor, wall}})
+	if len(grid) != 10 || len(grid[0]) != 10 {
+		t.Fatalf("Expected a 10x10 grid, got %dx%d", len(grid[0]), len(grid))
+	}
+	blocked := map[[2]int]bool{{0, 4}: true, {4, 0}: true, {7, 8}: true}
+	for y := range grid {
+		for x := range grid[y] {
+			if grid[y][x] != blocked[[2]int{x, y}] {
+				t.Fatalf("Expected sub-tile (%d, %d) to be blocked: %v", x, y, blocked[[2]int{x, y}])
+			}
+		}
+	}
+}
+
+func TestDT1Dependencies(t *testing.T) {
+	ds1 := NewDS1(1, 1, 18)
+	ds1.Files = []string{
+		`C:\Diablo II\D2\Data\Global\Tiles\ACT1\TOWN\Floor.tg1`,
+		`/d2/data/global/tiles/act1/town/floor.dt1`,
+		`C:\Diablo II\D2\Data\Global\Tiles\ACT1\TOWN\fence.tg1`,
+		`C:\Diablo II\D2\Data\Global\Tiles\ACT1\TOWN\notes.txt`,
+	}
+	dependencies := ds1.DT1Dependencies()
+	if len(dependencies) != 2 || dependencies[0] != `data\global\tiles\act1\town\floor.dt1` ||
+		dependencies[1] != `data\global\tiles\act1\town\fence.dt1` {
+		t.Fatalf("Expected the two tile files as archive paths, got %v", dependencies)
+	}
+}
+
+func TestResolveObject(t *testing.T) {
+	ds1 := NewDS1(1, 1, 18)
+	ds1.Objects = append(ds1.Objects,
+		d2data.Object{Type: int32(d2datadict.ObjectTypeCharacter), Id: 2},
+		d2data.Object{Type: int32(d2datadict.ObjectTypeCharacter), Id: 9999})
+	info, err := ds1.ResolveObject(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "akara-ACT 1 TABLE" || info.Type != d2datadict.ObjectTypeCharacter || info.Object != nil {
+		t.Fatalf("Expected the lookup description without loaded tables, got %+v", info)
+	}
+	if _, err := ds1.ResolveObject(1); err == nil {
+		t.Fatal("Expected an error for an unknown object id")
+	}
+	if _, err := ds1.ResolveObject(2); err == nil {
+		t.Fatal("Expected an error for an object index out of range")
+	}
+}
+
+func TestShadowTiles(t *testing.T) {
+	ds1 := NewDS1(2, 2, 18)
+	ds1.Tiles[0][1].Shadows[0] = FloorShadowRecord{Prop1: 1, MainIndex: 2, SubIndex: 3}
+	ds1.Tiles[1][0].Shadows[0] = FloorShadowRecord{Prop1: 1, Hidden: true}
+	tiles := ds1.ShadowTiles()
+	if len(tiles) != 1 {
+		t.Fatalf("Expected 1 shadow tile, got %d", len(tiles))
+	}
+	if tiles[0].X != 1 || tiles[0].Y != 0 || tiles[0].Record.MainIndex != 2 || tiles[0].Record.SubIndex != 3 {
+		t.Fatalf("Expected the shadow at 1,0, got %+v", tiles[0])
+	}
+}
+
+func TestResolveTile(t *testing.T) {
+	dt1 := &d2dt1.DT1{Tiles: []d2dt1.Tile{
+		{Orientation: 1, MainIndex: 2, SubIndex: 3, RarityFrameIndex: 1},
+		{Orientation: 1, MainIndex: 2, SubIndex: 3, RarityFrameIndex: 3},
+		{Orientation: 1, MainIndex: 2, SubIndex: 1},
+		{Orientation: 1, MainIndex: 5, SubIndex: 0},
+	}}
+	dt1s := []*d2dt1.DT1{dt1}
+	wall := WallRecord{Orientation: 1, MainIndex: 2, SubIndex: 3}
+	if tile, exact := ResolveTile(wall, dt1s, 0); !exact || tile != &dt1.Tiles[0] {
+		t.Fatal("Expected seed 0 to pick the first tile")
+	}
+	if tile, exact := ResolveTile(wall, dt1s, 3); !exact || tile != &dt1.Tiles[1] {
+		t.Fatal("Expected seed 3 to pick the more common tile")
+	}
+	wall.SubIndex = 7
+	if tile, exact := ResolveTile(wall, dt1s, 0); exact || tile != &dt1.Tiles[2] {
+		t.Fatal("Expected the tile with the lowest sub index as the fallback")
+	}
+	wall.MainIndex = 9
+	if tile, exact := ResolveTile(wall, dt1s, 0); exact || tile != nil {
+		t.Fatal("Expected no tile for an unknown main index")
+	}
+}
+
+func TestExportTiled(t *testing.T) {
+	ds1 := NewDS1(2, 1, 18)
+	ds1.Tiles[0][0].Floors[0] = FloorShadowRecord{Prop1: 1, MainIndex: 3, SubIndex: 4}
+	ds1.Tiles[0][1].Walls[0] = WallRecord{Prop1: 1, Orientation: byte(d2enum.RightWall), MainIndex: 5, SubIndex: 6}
+	buffer := new(bytes.Buffer)
+	if err := ExportTiled(ds1, buffer); err != nil {
+		t.Fatal(err)
+	}
+	var exported struct {
+		Width, Height int
+		Layers        []struct {
+			Name string
+			Data []uint32
+		}
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.Width != 2 || exported.Height != 1 || len(exported.Layers) != 3 {
+		t.Fatalf("Expected a 2x1 map with floor, wall and shadow layers, got %+v", exported)
+	}
+	floor, wall := exported.Layers[0], exported.Layers[1]
+	if floor.Name != "floor 1" || floor.Data[1] != 0 || wall.Name != "wall 1" || wall.Data[0] != 0 {
+		t.Fatalf("Expected empty cells for empty records, got %+v", exported.Layers)
+	}
+	if orientation, mainIndex, subIndex, ok := DecodeTiledGID(floor.Data[0]); !ok ||
+		orientation != byte(d2enum.Floors) || mainIndex != 3 || subIndex != 4 {
+		t.Fatalf("Expected the floor gid to decode to the record, got %d", floor.Data[0])
+	}
+	if orientation, mainIndex, subIndex, ok := DecodeTiledGID(wall.Data[1]); !ok ||
+		orientation != byte(d2enum.RightWall) || mainIndex != 5 || subIndex != 6 {
+		t.Fatalf("Expected the wall gid to decode to the record, got %d", wall.Data[1])
+	}
+}
@@ -0,0 +1,35 @@
+package d2ds1
+
+import (
+	"path"
+	"strings"
+)
+
+// tilesDirectory is the archive directory the DT1 files of maps are stored in
+const tilesDirectory = `data\global\tiles\`
+
+// DT1Dependencies returns the archive paths of the DT1 files the map uses, in the order of the file table. The table
+// holds the paths of the tile groups on the machine the map was made on, so they are converted to archive paths of
+// .dt1 files. Entries that are not tile files are skipped. Files before version 3 have no file table, so they return
+// an empty slice.
+func (v *DS1) DT1Dependencies() []string {
+	result := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, file := range v.Files {
+		file = strings.ToLower(strings.ReplaceAll(file, "/", `\`))
+		extension := path.Ext(file)
+		if extension != ".tg1" && extension != ".dt1" {
+			continue
+		}
+		start := strings.Index(file, tilesDirectory)
+		if start < 0 {
+			continue
+		}
+		dt1Path := strings.TrimSuffix(file[start:], extension) + ".dt1"
+		if !seen[dt1Path] {
+			seen[dt1Path] = true
+			result = append(result, dt1Path)
+		}
+	}
+	return result
+}
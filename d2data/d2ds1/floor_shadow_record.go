@@ -1,5 +1,9 @@
 package d2ds1
 
+import "github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+
+// FloorShadowRecord represents a tile of a floor or shadow layer. Unlike walls, these records do not store an
+// orientation: floor tiles always use the d2enum.Floors orientation and shadow tiles the d2enum.Shadows one.
 type FloorShadowRecord struct {
 	Prop1     byte
 	SubIndex  byte
@@ -8,3 +12,9 @@ type FloorShadowRecord struct {
 	Unknown2  byte
 	Hidden    bool
 }
+
+// Orientation returns the orientation of the DT1 tile a floor record is drawn with, which is always d2enum.Floors.
+// Records of a shadow layer are drawn with d2enum.Shadows instead.
+func (v FloorShadowRecord) Orientation() d2enum.Orientation {
+	return d2enum.Floors
+}
@@ -0,0 +1,178 @@
+package d2ds1
+
+import (
+	"fmt"
+
+	"github.com/OpenDiablo2/D2Shared/d2common"
+	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+)
+
+// Marshal encodes the map in the DS1 format of its version, so that ParseDS1 reads back the same map. Values the
+// format has no room for, such as the high bits of the Zero field of walls, are dropped.
+func (v *DS1) Marshal() ([]byte, error) {
+	if v.Version < minSupportedVersion || v.Version > maxSupportedVersion {
+		return nil, fmt.Errorf("ds1 version %d is not supported, expected a version from %d to %d",
+			v.Version, minSupportedVersion, maxSupportedVersion)
+	}
+	if _, err := v.reconcileLayerCounts(false); err != nil {
+		return nil, err
+	}
+	if len(v.Tiles) != int(v.Height) {
+		return nil, fmt.Errorf("ds1 has %d rows of tiles, but its height is %d", len(v.Tiles), v.Height)
+	}
+	for y := range v.Tiles {
+		if len(v.Tiles[y]) != int(v.Width) {
+			return nil, fmt.Errorf("ds1 row %d has %d tiles, but its width is %d", y, len(v.Tiles[y]), v.Width)
+		}
+	}
+	sw := d2common.CreateStreamWriter()
+	sw.PushUint32(uint32(v.Version))
+	sw.PushUint32(uint32(v.Width - 1))
+	sw.PushUint32(uint32(v.Height - 1))
+	if v.Version >= 8 {
+		sw.PushUint32(uint32(v.Act - 1))
+	}
+	if v.Version >= 10 {
+		sw.PushUint32(uint32(v.SubstitutionType))
+	}
+	if v.Version >= 3 {
+		sw.PushUint32(uint32(len(v.Files)))
+		for _, file := range v.Files {
+			for i := 0; i < len(file); i++ {
+				sw.PushByte(file[i])
+			}
+			sw.PushByte(0)
+		}
+	}
+	if v.Version >= 9 && v.Version <= 13 {
+		for i := 0; i < 16; i++ {
+			sw.PushByte(0)
+		}
+	}
+	if v.Version >= 4 {
+		sw.PushUint32(uint32(v.NumberOfWalls))
+		if v.Version >= 16 {
+			sw.PushUint32(uint32(v.NumberOfFloors))
+		}
+	}
+	for _, layerStreamType := range v.layerStreams() {
+		for y := 0; y < int(v.Height); y++ {
+			for x := 0; x < int(v.Width); x++ {
+				sw.PushUint32(v.encodeLayerRecord(&v.Tiles[y][x], layerStreamType))
+			}
+		}
+	}
+	if v.Version >= 2 {
+		sw.PushUint32(uint32(len(v.Objects)))
+		for _, object := range v.Objects {
+			sw.PushUint32(uint32(object.Type))
+			sw.PushUint32(uint32(object.Id))
+			sw.PushUint32(uint32(object.X))
+			sw.PushUint32(uint32(object.Y))
+			sw.PushUint32(uint32(object.Flags))
+		}
+	}
+	if v.Version >= 12 && (v.SubstitutionType == 1 || v.SubstitutionType == 2) {
+		if v.Version >= 18 {
+			sw.PushUint32(0)
+		}
+		sw.PushUint32(uint32(len(v.SubstitutionGroups)))
+		for _, group := range v.SubstitutionGroups {
+			sw.PushUint32(uint32(group.TileX))
+			sw.PushUint32(uint32(group.TileY))
+			sw.PushUint32(uint32(group.WidthInTiles))
+			sw.PushUint32(uint32(group.HeightInTiles))
+			sw.PushUint32(uint32(group.Unknown))
+		}
+	}
+	if v.Version >= 14 {
+		npcCount := 0
+		for _, object := range v.Objects {
+			if len(object.Paths) > 0 {
+				npcCount++
+			}
+		}
+		sw.PushUint32(uint32(npcCount))
+		for _, object := range v.Objects {
+			if len(object.Paths) == 0 {
+				continue
+			}
+			sw.PushUint32(uint32(len(object.Paths)))
+			sw.PushUint32(uint32(object.X))
+			sw.PushUint32(uint32(object.Y))
+			for _, path := range object.Paths {
+				sw.PushUint32(uint32(path.X))
+				sw.PushUint32(uint32(path.Y))
+				if v.Version >= 15 {
+					sw.PushUint32(uint32(path.Action))
+				}
+			}
+		}
+	}
+	return sw.GetBytes(), nil
+}
+
+// encodeLayerRecord encodes the record of a tile for one layer of the file. Records missing from the tile are 0.
+func (v *DS1) encodeLayerRecord(tile *TileRecord, layerStreamType d2enum.LayerStreamType) uint32 {
+	switch {
+	case layerStreamType >= d2enum.LayerStreamWall1 && layerStreamType <= d2enum.LayerStreamWall4:
+		wallIndex := int(layerStreamType - d2enum.LayerStreamWall1)
+		if wallIndex >= len(tile.Walls) {
+			return 0
+		}
+		wall := tile.Walls[wallIndex]
+		return encodeTileReference(wall.Prop1, wall.SubIndex, wall.Unknown1, wall.MainIndex, wall.Unknown2, wall.Hidden)
+	case layerStreamType >= d2enum.LayerStreamOrientation1 && layerStreamType <= d2enum.LayerStreamOrientation4:
+		wallIndex := int(layerStreamType - d2enum.LayerStreamOrientation1)
+		if wallIndex >= len(tile.Walls) {
+			return 0
+		}
+		wall := tile.Walls[wallIndex]
+		orientation := uint32(wall.Orientation)
+		if v.Version < 7 {
+			// Older versions store the orientations that dirLookup converts, so store the first one that converts to
+			// this orientation
+			for c, converted := range dirLookup {
+				if converted == int32(orientation) {
+					orientation = uint32(c)
+					break
+				}
+			}
+		}
+		return orientation | uint32(wall.Zero)<<8
+	case layerStreamType == d2enum.LayerStreamFloor1 || layerStreamType == d2enum.LayerStreamFloor2:
+		floorIndex := int(layerStreamType - d2enum.LayerStreamFloor1)
+		if floorIndex >= len(tile.Floors) {
+			return 0
+		}
+		floor := tile.Floors[floorIndex]
+		return encodeTileReference(floor.Prop1, floor.SubIndex, floor.Unknown1, floor.MainIndex, floor.Unknown2,
+			floor.Hidden)
+	case layerStreamType == d2enum.LayerStreamShadow:
+		if len(tile.Shadows) == 0 {
+			return 0
+		}
+		shadow := tile.Shadows[0]
+		return encodeTileReference(shadow.Prop1, shadow.SubIndex, shadow.Unknown1, shadow.MainIndex, shadow.Unknown2,
+			shadow.Hidden)
+	case layerStreamType == d2enum.LayerStreamSubstitute:
+		if len(tile.Substitutions) == 0 {
+			return 0
+		}
+		return tile.Substitutions[0].Unknown
+	}
+	return 0
+}
+
+// encodeTileReference packs the fields of a wall, floor or shadow record into the dword stored for it
+func encodeTileReference(prop1, subIndex, unknown1, mainIndex, unknown2 byte, hidden bool) uint32 {
+	result := uint32(prop1) |
+		(uint32(subIndex)&0x3F)<<8 |
+		(uint32(unknown1)&0x3F)<<14 |
+		(uint32(mainIndex)&0x3F)<<20 |
+		(uint32(unknown2)&0x1F)<<26
+	if hidden {
+		result |= 0x80000000
+	}
+	return result
+}
@@ -0,0 +1,50 @@
+package d2ds1
+
+import "fmt"
+
+// PathAction is the action an NPC performs when it reaches a point of its path
+type PathAction int
+
+const (
+	// PathActionNone is used for the points of version 14 and older files, which do not store actions
+	PathActionNone   PathAction = 0
+	PathActionWalk   PathAction = 1
+	PathActionRun    PathAction = 2
+	PathActionAttack PathAction = 3
+)
+
+// String returns the name of the action, or its code for actions without a name
+func (v PathAction) String() string {
+	switch v {
+	case PathActionNone:
+		return "None"
+	case PathActionWalk:
+		return "Walk"
+	case PathActionRun:
+		return "Run"
+	case PathActionAttack:
+		return "Attack"
+	}
+	return fmt.Sprintf("PathAction(%d)", int(v))
+}
+
+// PathPoint is a point of the path an NPC walks along
+type PathPoint struct {
+	X, Y int
+	// Action is only stored by version 15 and later files, and is PathActionNone for older ones. Codes without a
+	// named constant are kept as they are.
+	Action PathAction
+}
+
+// ObjectPath returns the path of the object at the index in Objects. Objects without a path return an empty slice.
+func (v *DS1) ObjectPath(objectIndex int) ([]PathPoint, error) {
+	if objectIndex < 0 || objectIndex >= len(v.Objects) {
+		return nil, fmt.Errorf("object %d is out of range, the map has %d objects", objectIndex, len(v.Objects))
+	}
+	paths := v.Objects[objectIndex].Paths
+	result := make([]PathPoint, len(paths))
+	for i, path := range paths {
+		result[i] = PathPoint{X: int(path.X), Y: int(path.Y), Action: PathAction(path.Action)}
+	}
+	return result, nil
+}
@@ -0,0 +1,25 @@
+package d2ds1
+
+// PlacedTile is a floor or shadow record together with its position in the map
+type PlacedTile struct {
+	X, Y   int // Position of the tile, in tiles
+	Layer  int // Index of the layer the record is in
+	Record FloorShadowRecord
+}
+
+// ShadowTiles returns the shadow tiles of the map, row by row, so they can be drawn in their own pass beneath the
+// walls and entities. Hidden and empty records are left out. The tiles use the d2enum.Shadows orientation.
+func (v *DS1) ShadowTiles() []PlacedTile {
+	result := make([]PlacedTile, 0)
+	for y, row := range v.Tiles {
+		for x, tile := range row {
+			for layer, shadow := range tile.Shadows {
+				if shadow.Hidden || shadow.Prop1 == 0 {
+					continue
+				}
+				result = append(result, PlacedTile{X: x, Y: y, Layer: layer, Record: shadow})
+			}
+		}
+	}
+	return result
+}
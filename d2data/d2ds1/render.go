@@ -0,0 +1,93 @@
+package d2ds1
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"sort"
+
+	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2dt1"
+)
+
+// Size of the floor diamond of a tile on screen
+const (
+	tileScreenWidth  = 160
+	tileScreenHeight = 80
+)
+
+// tileSprite is a tile graphic placed on the map preview
+type tileSprite struct {
+	tile     *d2dt1.Tile
+	position image.Point // Top left corner of the floor diamond
+}
+
+// RenderDS1 renders a preview of the map, placing the floor, wall and roof tiles in isometric projection. All floors
+// are drawn first, then the walls from the back of the map to the front so walls closer to the viewer cover the ones
+// behind them, and the roofs last. Tiles that are not found in the DT1 files are skipped.
+func RenderDS1(ds1 *DS1, dt1s []*d2dt1.DT1, palette d2datadict.PaletteRec) (*image.RGBA, error) {
+	var floors, walls, roofs []tileSprite
+	for y := 0; y < int(ds1.Height); y++ {
+		for x := 0; x < int(ds1.Width); x++ {
+			position := image.Pt(((x-y)*tileScreenWidth/2)-(tileScreenWidth/2), (x+y)*tileScreenHeight/2)
+			tile := &ds1.Tiles[y][x]
+			for _, floor := range tile.Floors {
+				if floor.Hidden || floor.Prop1 == 0 {
+					continue
+				}
+				if dt1Tile := findTile(dt1s, int32(d2enum.Floors), floor.MainIndex, floor.SubIndex); dt1Tile != nil {
+					floors = append(floors, tileSprite{tile: dt1Tile, position: position})
+				}
+			}
+			for _, wall := range tile.Walls {
+				if !wall.Visible() || wall.Prop1 == 0 {
+					continue
+				}
+				orientations := []int32{int32(wall.Orientation)}
+				if d2enum.Orientation(wall.Orientation) == d2enum.RightPartOfNorthCornerWall {
+					// North corners are made of two tiles, the left part is not stored in the map
+					orientations = append(orientations, int32(d2enum.LeftPartOfNorthCornerWall))
+				}
+				for _, orientation := range orientations {
+					dt1Tile := findTile(dt1s, orientation, wall.MainIndex, wall.SubIndex)
+					if dt1Tile == nil {
+						continue
+					}
+					if d2enum.Orientation(orientation) == d2enum.Roofs {
+						roofs = append(roofs, tileSprite{
+							tile:     dt1Tile,
+							position: position.Sub(image.Pt(0, int(dt1Tile.RoofHeight))),
+						})
+					} else {
+						walls = append(walls, tileSprite{tile: dt1Tile, position: position})
+					}
+				}
+			}
+		}
+	}
+	sortByDepth(walls)
+	sortByDepth(roofs)
+	sprites := append(append(floors, walls...), roofs...)
+	if len(sprites) == 0 {
+		return nil, errors.New("ds1 has no tiles that could be found in the dt1 files")
+	}
+	bounds := image.Rectangle{}
+	for _, sprite := range sprites {
+		bounds = bounds.Union(sprite.tile.Bounds().Add(sprite.position))
+	}
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for _, sprite := range sprites {
+		img, origin := sprite.tile.Image(palette)
+		target := img.Rect.Add(origin).Add(sprite.position).Sub(bounds.Min)
+		draw.Draw(result, target, img, image.Point{}, draw.Over)
+	}
+	return result, nil
+}
+
+// sortByDepth orders the sprites from the back of the map to the front, keeping the order of sprites at the same depth
+func sortByDepth(sprites []tileSprite) {
+	sort.SliceStable(sprites, func(i, j int) bool {
+		return sprites[i].position.Y < sprites[j].position.Y
+	})
+}
@@ -0,0 +1,47 @@
+package d2ds1
+
+import (
+	"fmt"
+
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+// ObjectInfo describes what an object placed in a map is
+type ObjectInfo struct {
+	// Name is the Name column of Objects.txt for objects, and the Id column of MonStats.txt for characters. It falls
+	// back to the description of the lookup record when the table is not loaded.
+	Name   string
+	Type   d2datadict.ObjectType
+	Lookup *d2datadict.ObjectLookupRecord
+	Object *d2datadict.ObjectRecord // Objects.txt record, nil for characters or when Objects.txt is not loaded
+}
+
+// ResolveObject resolves the type and id of the object at the index in Objects against the lookup table of the map's
+// act and the loaded Objects.txt and MonStats.txt records. It returns an error if the lookup table has no entry for
+// the object.
+func (v *DS1) ResolveObject(objectIndex int) (ObjectInfo, error) {
+	if objectIndex < 0 || objectIndex >= len(v.Objects) {
+		return ObjectInfo{}, fmt.Errorf("object %d is out of range, the map has %d objects", objectIndex, len(v.Objects))
+	}
+	object := v.Objects[objectIndex]
+	lookup := d2datadict.FindObjectLookup(int(v.Act), int(object.Type), int(object.Id))
+	if lookup == nil {
+		return ObjectInfo{}, fmt.Errorf("object %d has type %d and id %d, which act %d does not define",
+			objectIndex, object.Type, object.Id, v.Act)
+	}
+	result := ObjectInfo{Name: lookup.Description, Type: lookup.Type, Lookup: lookup}
+	if lookup.ObjectsTxtId >= 0 {
+		if record := d2datadict.Objects[lookup.ObjectsTxtId]; record != nil {
+			result.Object = record
+			result.Name = record.Name
+		}
+	}
+	if lookup.MonstatsTxtId >= 0 && d2datadict.MonStatsDictionary != nil {
+		monStats := d2datadict.MonStatsDictionary
+		if _, ok := monStats.FieldNameLookup["Id"]; ok && lookup.MonstatsTxtId < len(monStats.Data) &&
+			monStats.Data[lookup.MonstatsTxtId] != nil {
+			result.Name = monStats.GetString("Id", lookup.MonstatsTxtId)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,56 @@
+package d2ds1
+
+import "github.com/OpenDiablo2/D2Shared/d2data/d2dt1"
+
+// ResolveTile finds the DT1 tile a wall record is drawn with. The record does not store which of the tiles with its
+// orientation, main index and sub index is used, so one of them is picked with a chance proportional to its rarity.
+// The seed selects the tile, so the same seed always picks the same one; callers usually derive it from the position
+// of the tile in the map. When all candidates have a rarity of 0, the first one is used.
+//
+// When no tile matches exactly, the tile with the same orientation and main index and the lowest sub index is used as
+// the fallback, and false is returned to tell that the match is not exact. If there is no such tile either, the result
+// is nil.
+func ResolveTile(wall WallRecord, dt1s []*d2dt1.DT1, seed uint32) (*d2dt1.Tile, bool) {
+	return resolveTile(dt1s, int32(wall.Orientation), int32(wall.MainIndex), int32(wall.SubIndex), seed)
+}
+
+func resolveTile(dt1s []*d2dt1.DT1, orientation, mainIndex, subIndex int32, seed uint32) (*d2dt1.Tile, bool) {
+	var (
+		candidates  []*d2dt1.Tile
+		totalWeight uint32
+		fallback    *d2dt1.Tile
+	)
+	for _, dt1 := range dt1s {
+		for idx := range dt1.Tiles {
+			tile := &dt1.Tiles[idx]
+			if tile.Orientation != orientation || tile.MainIndex != mainIndex {
+				continue
+			}
+			if tile.SubIndex == subIndex {
+				candidates = append(candidates, tile)
+				if tile.RarityFrameIndex > 0 {
+					totalWeight += uint32(tile.RarityFrameIndex)
+				}
+			} else if fallback == nil || tile.SubIndex < fallback.SubIndex {
+				fallback = tile
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return fallback, false
+	}
+	if totalWeight == 0 {
+		return candidates[0], true
+	}
+	pick := seed % totalWeight
+	for _, tile := range candidates {
+		if tile.RarityFrameIndex <= 0 {
+			continue
+		}
+		if pick < uint32(tile.RarityFrameIndex) {
+			return tile, true
+		}
+		pick -= uint32(tile.RarityFrameIndex)
+	}
+	return candidates[0], true
+}
@@ -0,0 +1,90 @@
+package d2ds1
+
+import "fmt"
+
+// StampOptions configures how a map is stamped into another
+type StampOptions struct {
+	// Grow extends the width and height of the target map when the stamped map does not fit into it. Without it,
+	// stamping past the edges is an error.
+	Grow bool
+}
+
+// Stamp copies the floor, wall and shadow records of the other map into this map, with the top left tile of the other
+// map at (atX, atY). It returns an error if the other map does not fit.
+func (v *DS1) Stamp(other *DS1, atX, atY int) error {
+	return v.StampWithOptions(other, atX, atY, StampOptions{})
+}
+
+// StampWithOptions copies the floor, wall and shadow records of the other map into this map, with the top left tile
+// of the other map at (atX, atY). The stamped tiles replace the records of the tiles they cover. If the other map
+// uses more wall or floor layers, the layers are added to this map. Objects and substitution groups are not copied.
+func (v *DS1) StampWithOptions(other *DS1, atX, atY int, options StampOptions) error {
+	if atX < 0 || atY < 0 {
+		return fmt.Errorf("can not stamp a map at (%d, %d), the position must not be negative", atX, atY)
+	}
+	width := atX + int(other.Width)
+	height := atY + int(other.Height)
+	if (width > int(v.Width) || height > int(v.Height)) && !options.Grow {
+		return fmt.Errorf("%dx%d map stamped at (%d, %d) does not fit into the %dx%d map",
+			other.Width, other.Height, atX, atY, v.Width, v.Height)
+	}
+	if other.NumberOfWalls > v.NumberOfWalls {
+		v.NumberOfWalls = other.NumberOfWalls
+	}
+	if other.NumberOfFloors > v.NumberOfFloors {
+		v.NumberOfFloors = other.NumberOfFloors
+	}
+	if other.NumberOfShadowLayers > v.NumberOfShadowLayers {
+		v.NumberOfShadowLayers = other.NumberOfShadowLayers
+	}
+	if width > int(v.Width) {
+		v.Width = int32(width)
+	}
+	if height > int(v.Height) {
+		v.Height = int32(height)
+	}
+	v.resizeTiles()
+	for y := 0; y < int(other.Height); y++ {
+		for x := 0; x < int(other.Width); x++ {
+			source := &other.Tiles[y][x]
+			target := &v.Tiles[atY+y][atX+x]
+			for i := copy(target.Walls, source.Walls); i < len(target.Walls); i++ {
+				target.Walls[i] = WallRecord{}
+			}
+			for i := copy(target.Floors, source.Floors); i < len(target.Floors); i++ {
+				target.Floors[i] = FloorShadowRecord{}
+			}
+			for i := copy(target.Shadows, source.Shadows); i < len(target.Shadows); i++ {
+				target.Shadows[i] = FloorShadowRecord{}
+			}
+		}
+	}
+	return nil
+}
+
+// resizeTiles makes the tile grid match the map size and layer counts, keeping the records already in it
+func (v *DS1) resizeTiles() {
+	for len(v.Tiles) < int(v.Height) {
+		v.Tiles = append(v.Tiles, nil)
+	}
+	for y := range v.Tiles {
+		for len(v.Tiles[y]) < int(v.Width) {
+			v.Tiles[y] = append(v.Tiles[y], TileRecord{})
+		}
+		for x := range v.Tiles[y] {
+			tile := &v.Tiles[y][x]
+			for len(tile.Walls) < int(v.NumberOfWalls) {
+				tile.Walls = append(tile.Walls, WallRecord{})
+			}
+			for len(tile.Floors) < int(v.NumberOfFloors) {
+				tile.Floors = append(tile.Floors, FloorShadowRecord{})
+			}
+			for len(tile.Shadows) < int(v.NumberOfShadowLayers) {
+				tile.Shadows = append(tile.Shadows, FloorShadowRecord{})
+			}
+			for len(tile.Substitutions) < int(v.NumberOfSubstitutionLayers) {
+				tile.Substitutions = append(tile.Substitutions, SubstitutionRecord{})
+			}
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package d2ds1
 
+// SubstitutionRecord is the tag layer of a tile. It is only present in version 10 and later files whose
+// SubstitutionType is 1 or 2.
 type SubstitutionRecord struct {
 	Unknown uint32
 }
+
+// Tagged returns true if the tile is tagged, which the automap uses to find the borders of the tagged areas
+func (v SubstitutionRecord) Tagged() bool {
+	return v.Unknown != 0
+}
@@ -0,0 +1,157 @@
+package d2ds1
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+)
+
+// tiledOrientationCount is the number of tile orientations, which is the number of orientation slots in a Tiled gid
+const tiledOrientationCount = 20
+
+// tiledLayer is a tile layer of a Tiled JSON map
+type tiledLayer struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	X       int      `json:"x"`
+	Y       int      `json:"y"`
+	Width   int      `json:"width"`
+	Height  int      `json:"height"`
+	Opacity float64  `json:"opacity"`
+	Visible bool     `json:"visible"`
+	Data    []uint32 `json:"data"`
+}
+
+// tiledTileset is the tileset the gids of an exported map refer to. It has no images, the tiles only reserve the gids.
+type tiledTileset struct {
+	FirstGID   int    `json:"firstgid"`
+	Name       string `json:"name"`
+	TileWidth  int    `json:"tilewidth"`
+	TileHeight int    `json:"tileheight"`
+	TileCount  int    `json:"tilecount"`
+	Columns    int    `json:"columns"`
+}
+
+// tiledMap is the Tiled JSON map document
+type tiledMap struct {
+	Type         string         `json:"type"`
+	Version      string         `json:"version"`
+	Orientation  string         `json:"orientation"`
+	RenderOrder  string         `json:"renderorder"`
+	Infinite     bool           `json:"infinite"`
+	Width        int            `json:"width"`
+	Height       int            `json:"height"`
+	TileWidth    int            `json:"tilewidth"`
+	TileHeight   int            `json:"tileheight"`
+	NextLayerID  int            `json:"nextlayerid"`
+	NextObjectID int            `json:"nextobjectid"`
+	Layers       []tiledLayer   `json:"layers"`
+	Tilesets     []tiledTileset `json:"tilesets"`
+}
+
+// TiledGID returns the Tiled gid of a tile. The gid is 1 + (orientation << 12 | main index << 6 | sub index), so every
+// combination of the 6 bit main and sub indices of each orientation has its own gid, and 0 stays free for empty
+// cells.
+func TiledGID(orientation, mainIndex, subIndex byte) uint32 {
+	return 1 + (uint32(orientation)<<12 | uint32(mainIndex&0x3F)<<6 | uint32(subIndex&0x3F))
+}
+
+// DecodeTiledGID returns the orientation, main index and sub index of a gid made by TiledGID. It returns false for
+// empty cells and for gids outside the range TiledGID produces. Tiled stores flipped tiles in the high bits of the
+// gid, which are not cleared, as flipped tiles have no meaning in a map.
+func DecodeTiledGID(gid uint32) (orientation, mainIndex, subIndex byte, ok bool) {
+	if gid == 0 || gid > tiledOrientationCount<<12 {
+		return 0, 0, 0, false
+	}
+	tile := gid - 1
+	return byte(tile >> 12), byte((tile >> 6) & 0x3F), byte(tile & 0x3F), true
+}
+
+// ExportTiled writes the map as a Tiled JSON map with isometric orientation. Every floor, wall and shadow layer becomes
+// a tile layer, named "floor 1", "wall 1" and so on, whose cells hold the gids TiledGID makes from the records. Floor
+// records use the d2enum.Floors orientation and shadow records the d2enum.Shadows one. Empty records, whose Prop1 is
+// 0, and hidden records are written as empty cells. The map has a single tileset without images that reserves the
+// gids, so the tiles can be assigned graphics in the editor.
+func ExportTiled(ds1 *DS1, w io.Writer) error {
+	width, height := int(ds1.Width), int(ds1.Height)
+	if len(ds1.Tiles) != height {
+		return fmt.Errorf("ds1 has %d rows of tiles, but its height is %d", len(ds1.Tiles), height)
+	}
+	for _, row := range ds1.Tiles {
+		if len(row) != width {
+			return fmt.Errorf("ds1 has a row of %d tiles, but its width is %d", len(row), width)
+		}
+	}
+	result := tiledMap{
+		Type:         "map",
+		Version:      "1.10",
+		Orientation:  "isometric",
+		RenderOrder:  "right-down",
+		Width:        width,
+		Height:       height,
+		TileWidth:    tileScreenWidth,
+		TileHeight:   tileScreenHeight,
+		NextObjectID: 1,
+		Layers:       make([]tiledLayer, 0),
+		Tilesets: []tiledTileset{{
+			FirstGID:   1,
+			Name:       "dt1",
+			TileWidth:  tileScreenWidth,
+			TileHeight: tileScreenHeight,
+			TileCount:  tiledOrientationCount << 12,
+			Columns:    64,
+		}},
+	}
+	addLayer := func(name string, gid func(tile TileRecord) uint32) {
+		layer := tiledLayer{
+			ID:      len(result.Layers) + 1,
+			Name:    name,
+			Type:    "tilelayer",
+			Width:   width,
+			Height:  height,
+			Opacity: 1,
+			Visible: true,
+			Data:    make([]uint32, 0, width*height),
+		}
+		for _, row := range ds1.Tiles {
+			for _, tile := range row {
+				layer.Data = append(layer.Data, gid(tile))
+			}
+		}
+		result.Layers = append(result.Layers, layer)
+	}
+	for i := 0; i < int(ds1.NumberOfFloors); i++ {
+		addLayer(fmt.Sprintf("floor %d", i+1), func(tile TileRecord) uint32 {
+			return floorShadowGID(tile.Floors, i, d2enum.Floors)
+		})
+	}
+	for i := 0; i < int(ds1.NumberOfWalls); i++ {
+		addLayer(fmt.Sprintf("wall %d", i+1), func(tile TileRecord) uint32 {
+			if i >= len(tile.Walls) || tile.Walls[i].Hidden || tile.Walls[i].Prop1 == 0 {
+				return 0
+			}
+			wall := tile.Walls[i]
+			return TiledGID(wall.Orientation, wall.MainIndex, wall.SubIndex)
+		})
+	}
+	for i := 0; i < int(ds1.NumberOfShadowLayers); i++ {
+		addLayer(fmt.Sprintf("shadow %d", i+1), func(tile TileRecord) uint32 {
+			return floorShadowGID(tile.Shadows, i, d2enum.Shadows)
+		})
+	}
+	result.NextLayerID = len(result.Layers) + 1
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// floorShadowGID returns the gid of the record at the index, or 0 if there is no such record or it is not drawn
+func floorShadowGID(records []FloorShadowRecord, index int, orientation d2enum.Orientation) uint32 {
+	if index >= len(records) || records[index].Hidden || records[index].Prop1 == 0 {
+		return 0
+	}
+	return TiledGID(byte(orientation), records[index].MainIndex, records[index].SubIndex)
+}
@@ -1,5 +1,7 @@
 package d2ds1
 
+import "github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+
 type WallRecord struct {
 	Orientation byte
 	Zero        byte
@@ -10,3 +12,12 @@ type WallRecord struct {
 	Unknown2    byte
 	Hidden      bool
 }
+
+// Visible returns true if the wall should be drawn. Hidden walls and special tile placeholders are never drawn.
+func (v WallRecord) Visible() bool {
+	if v.Hidden {
+		return false
+	}
+	orientation := d2enum.Orientation(v.Orientation)
+	return orientation != d2enum.SpecialTile1 && orientation != d2enum.SpecialTile2
+}
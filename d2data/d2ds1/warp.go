@@ -0,0 +1,45 @@
+package d2ds1
+
+import "github.com/OpenDiablo2/D2Shared/d2common/d2enum"
+
+// warpMainIndex is the main index of the special tiles that mark a warp to another level
+const warpMainIndex = 30
+
+// minWarpVersion is the first file version whose special tiles mark warps. Older files store the orientation codes
+// remapped by dirLookup, and their special tiles are not read as warps.
+const minWarpVersion = 7
+
+// WarpRecord is a warp to another level, marked in the map by a special wall tile
+type WarpRecord struct {
+	X, Y int // Tile the warp is on
+	// Index selects the connected level from the Vis0 to Vis7 columns of the level's Levels.txt record
+	Index int
+	// TargetLevelId is the id of the connected level, or 0 when the Vis column selected by Index is empty
+	TargetLevelId int
+}
+
+// Warps returns the warps to other levels placed on the map. levelVis holds the Vis0 to Vis7 columns of the map's
+// Levels.txt record, which the map does not store itself. Maps without warp tiles, and files older than
+// version 7, return an empty slice.
+func (v *DS1) Warps(levelVis [8]int) []WarpRecord {
+	result := make([]WarpRecord, 0)
+	if v.Version < minWarpVersion {
+		return result
+	}
+	for y := range v.Tiles {
+		for x := range v.Tiles[y] {
+			for _, wall := range v.Tiles[y][x].Walls {
+				orientation := d2enum.Orientation(wall.Orientation)
+				if (orientation == d2enum.SpecialTile1 || orientation == d2enum.SpecialTile2) &&
+					wall.MainIndex == warpMainIndex {
+					warp := WarpRecord{X: x, Y: y, Index: int(wall.SubIndex)}
+					if warp.Index < len(levelVis) {
+						warp.TargetLevelId = levelVis[warp.Index]
+					}
+					result = append(result, warp)
+				}
+			}
+		}
+	}
+	return result
+}
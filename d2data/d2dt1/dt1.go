@@ -39,7 +39,8 @@ func LoadDT1(path string, fileProvider d2interface.FileProvider) DT1 {
 		newTile.Direction = br.GetInt32()
 		newTile.RoofHeight = br.GetInt16()
 		newTile.SoundIndex = br.GetByte()
-		newTile.Animated = br.GetByte() == 1
+		newTile.materialHigh = br.GetByte()
+		newTile.Animated = newTile.materialHigh == 1
 		newTile.Height = br.GetInt32()
 		newTile.Width = br.GetInt32()
 		br.SkipBytes(4)
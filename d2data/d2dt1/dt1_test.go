@@ -0,0 +1,75 @@
+package d2dt1
+
+import (
+	"testing"
+
+	"github.com/OpenDiablo2/D2Shared/d2common"
+)
+
+type testFileProvider map[string][]byte
+
+func (v testFileProvider) LoadFile(fileName string) []byte {
+	return v[fileName]
+}
+
+// encodeTestDT1 encodes a file with a single tile without blocks, using the given material bytes
+func encodeTestDT1(soundIndex, materialHigh byte) []byte {
+	sw := d2common.CreateStreamWriter()
+	sw.PushUint32(7)
+	sw.PushUint32(6)
+	for i := 0; i < 260; i++ {
+		sw.PushByte(0)
+	}
+	sw.PushUint32(1)   // Number of tiles
+	sw.PushUint32(276) // Tile header offset
+	sw.PushUint32(0)   // Direction
+	sw.PushInt16(0)    // Roof height
+	sw.PushByte(soundIndex)
+	sw.PushByte(materialHigh)
+	for i := 0; i < 8*4+25+7; i++ {
+		sw.PushByte(0)
+	}
+	sw.PushUint32(372) // Block header pointer
+	sw.PushUint32(0)   // Block header size
+	sw.PushUint32(0)   // Number of blocks
+	for i := 0; i < 12; i++ {
+		sw.PushByte(0)
+	}
+	return sw.GetBytes()
+}
+
+func TestMaterial(t *testing.T) {
+	tests := []struct {
+		soundIndex   byte
+		materialHigh byte
+		material     MaterialType
+		name         string
+		animated     bool
+	}{
+		{0x00, 0x00, 0, "None", false},
+		{0x20, 0x00, MaterialDirt, "Dirt", false},
+		{0x0A, 0x00, MaterialWater | MaterialInsideStone, "Water|InsideStone", false},
+		{0x00, 0x01, MaterialLava, "Lava", true},
+		{0x40, 0x04, MaterialSand | MaterialSnow, "Sand|Snow", false},
+	}
+	for _, test := range tests {
+		dt1 := LoadDT1("test.dt1", testFileProvider{"test.dt1": encodeTestDT1(test.soundIndex, test.materialHigh)})
+		if len(dt1.Tiles) != 1 {
+			t.Fatalf("Expected 1 tile, got %d", len(dt1.Tiles))
+		}
+		tile := dt1.Tiles[0]
+		if material := tile.Material(); material != test.material {
+			t.Errorf("Expected material %#04x for bytes %#02x %#02x, got %#04x",
+				test.material, test.soundIndex, test.materialHigh, material)
+		}
+		if name := tile.Material().String(); name != test.name {
+			t.Errorf("Expected material name %q, got %q", test.name, name)
+		}
+		if tile.Animated != test.animated {
+			t.Errorf("Expected Animated to be %v for bytes %#02x %#02x", test.animated, test.soundIndex, test.materialHigh)
+		}
+	}
+	if !(MaterialWood | MaterialSnow).Has(MaterialSnow) || MaterialWood.Has(MaterialWood|MaterialSnow) {
+		t.Error("Has does not match the set flags")
+	}
+}
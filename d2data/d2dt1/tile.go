@@ -1,10 +1,13 @@
 package d2dt1
 
+import "strings"
+
 type Tile struct {
 	Direction          int32
 	RoofHeight         int16
 	SoundIndex         byte
 	Animated           bool
+	materialHigh       byte
 	Height             int32
 	Width              int32
 	Orientation        int32
@@ -16,3 +19,89 @@ type Tile struct {
 	blockHeaderSize    int32
 	Blocks             []Block
 }
+
+// SubTileBlockWalk is the sub-tile flag set when the sub-tile can not be walked on
+const SubTileBlockWalk = 0x01
+
+// subTileLookup maps the sub-tile grid, from the top row down, to the index in SubTileFlags. The flags are stored
+// starting with the bottom row.
+var subTileLookup = [5][5]int{
+	{20, 21, 22, 23, 24},
+	{15, 16, 17, 18, 19},
+	{10, 11, 12, 13, 14},
+	{5, 6, 7, 8, 9},
+	{0, 1, 2, 3, 4},
+}
+
+// SubTileFlagsAt returns the flags of the sub-tile at the given position, where (0, 0) is the top left sub-tile
+func (v *Tile) SubTileFlagsAt(x, y int) byte {
+	return v.SubTileFlags[subTileLookup[y][x]]
+}
+
+// CollisionMask returns, indexed by [y][x], which of the 5x5 sub-tiles block walking
+func (v *Tile) CollisionMask() [5][5]bool {
+	var result [5][5]bool
+	for y := range result {
+		for x := range result[y] {
+			result[y][x] = (v.SubTileFlagsAt(x, y) & SubTileBlockWalk) != 0
+		}
+	}
+	return result
+}
+
+// MaterialType holds the material flags of a floor tile, which the game uses to pick the footstep sounds played on
+// it. The low byte is the SoundIndex byte of the tile header and the high byte is the byte after it.
+type MaterialType uint16
+
+const (
+	MaterialOther        MaterialType = 0x0001
+	MaterialWater        MaterialType = 0x0002
+	MaterialWoodObject   MaterialType = 0x0004
+	MaterialInsideStone  MaterialType = 0x0008
+	MaterialOutsideStone MaterialType = 0x0010
+	MaterialDirt         MaterialType = 0x0020
+	MaterialSand         MaterialType = 0x0040
+	MaterialWood         MaterialType = 0x0080
+	MaterialLava         MaterialType = 0x0100
+	MaterialSnow         MaterialType = 0x0400
+)
+
+var materialNames = []struct {
+	flag MaterialType
+	name string
+}{
+	{MaterialOther, "Other"},
+	{MaterialWater, "Water"},
+	{MaterialWoodObject, "WoodObject"},
+	{MaterialInsideStone, "InsideStone"},
+	{MaterialOutsideStone, "OutsideStone"},
+	{MaterialDirt, "Dirt"},
+	{MaterialSand, "Sand"},
+	{MaterialWood, "Wood"},
+	{MaterialLava, "Lava"},
+	{MaterialSnow, "Snow"},
+}
+
+// Has returns true when all of the given material flags are set
+func (v MaterialType) Has(flags MaterialType) bool {
+	return v&flags == flags
+}
+
+// String returns the names of the set material flags joined with "|"
+func (v MaterialType) String() string {
+	var names []string
+	for _, material := range materialNames {
+		if v.Has(material.flag) {
+			names = append(names, material.name)
+		}
+	}
+	if len(names) == 0 {
+		return "None"
+	}
+	return strings.Join(names, "|")
+}
+
+// Material returns the decoded material flags of the tile
+func (v *Tile) Material() MaterialType {
+	return MaterialType(v.SoundIndex) | MaterialType(v.materialHigh)<<8
+}
@@ -0,0 +1,96 @@
+package d2dt1
+
+import (
+	"image"
+
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+// Dimensions of the blocks a tile is made of. Isometric blocks hold a 32x15 diamond, RLE blocks are up to 32x32.
+const (
+	blockWidth           = 32
+	isometricBlockHeight = 15
+	rleBlockHeight       = 32
+)
+
+// Start and length of each row of an isometric block
+var (
+	isometricRowStart  = [isometricBlockHeight]int{14, 12, 10, 8, 6, 4, 2, 0, 2, 4, 6, 8, 10, 12, 14}
+	isometricRowLength = [isometricBlockHeight]int{4, 8, 12, 16, 20, 24, 28, 32, 28, 24, 20, 16, 12, 8, 4}
+)
+
+// Bounds returns the area covered by the blocks of the tile, relative to the top left corner of the floor diamond.
+// Walls extend above it, so their bounds start at a negative Y.
+func (v *Tile) Bounds() image.Rectangle {
+	result := image.Rectangle{}
+	for _, block := range v.Blocks {
+		height := rleBlockHeight
+		if block.Format == BlockFormatIsometric {
+			height = isometricBlockHeight
+		}
+		result = result.Union(image.Rect(int(block.X), int(block.Y), int(block.X)+blockWidth, int(block.Y)+height))
+	}
+	return result
+}
+
+// Image renders the tile with the palette, and returns it with the position of its top left corner relative to the
+// top left corner of the floor diamond. Palette index 0 is transparent.
+func (v *Tile) Image(palette d2datadict.PaletteRec) (*image.RGBA, image.Point) {
+	bounds := v.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	setPixel := func(x, y int, paletteIndex byte) {
+		point := image.Pt(x, y).Sub(bounds.Min)
+		if paletteIndex == 0 || !point.In(result.Rect) {
+			return
+		}
+		color := palette.Colors[paletteIndex]
+		offset := result.PixOffset(point.X, point.Y)
+		result.Pix[offset] = color.R
+		result.Pix[offset+1] = color.G
+		result.Pix[offset+2] = color.B
+		result.Pix[offset+3] = 0xFF
+	}
+	for _, block := range v.Blocks {
+		if block.Format == BlockFormatIsometric {
+			decodeIsometricBlock(block, setPixel)
+		} else {
+			decodeRLEBlock(block, setPixel)
+		}
+	}
+	return result, bounds.Min
+}
+
+func decodeIsometricBlock(block Block, setPixel func(x, y int, paletteIndex byte)) {
+	dataPointer := 0
+	for y := 0; y < isometricBlockHeight; y++ {
+		for x := isometricRowStart[y]; x < isometricRowStart[y]+isometricRowLength[y]; x++ {
+			if dataPointer >= len(block.EncodedData) {
+				return
+			}
+			setPixel(int(block.X)+x, int(block.Y)+y, block.EncodedData[dataPointer])
+			dataPointer++
+		}
+	}
+}
+
+// decodeRLEBlock decodes a block made of (skip, count) pairs followed by count pixels. A pair of zeroes ends the row.
+func decodeRLEBlock(block Block, setPixel func(x, y int, paletteIndex byte)) {
+	x, y := 0, 0
+	dataPointer := 0
+	for dataPointer+1 < len(block.EncodedData) {
+		skip := int(block.EncodedData[dataPointer])
+		count := int(block.EncodedData[dataPointer+1])
+		dataPointer += 2
+		if skip == 0 && count == 0 {
+			x = 0
+			y++
+			continue
+		}
+		x += skip
+		for ; count > 0 && dataPointer < len(block.EncodedData); count-- {
+			setPixel(int(block.X)+x, int(block.Y)+y, block.EncodedData[dataPointer])
+			dataPointer++
+			x++
+		}
+	}
+}
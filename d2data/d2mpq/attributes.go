@@ -0,0 +1,65 @@
+package d2mpq
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// attributesCRC32 is the flag of the (attributes) file that is set when it stores the CRC32 of every block
+const attributesCRC32 = 0x01
+
+// attributesFileName is the name of the file that stores the per block attributes
+const attributesFileName = "(attributes)"
+
+// ErrNoFileCRC is returned by VerifyFileCRC when the archive stores no CRC32 for the file
+var ErrNoFileCRC = errors.New("mpq has no crc32 for the file")
+
+// VerifyFileCRC compares the CRC32 of a file's content with the one stored in the (attributes) file. It returns
+// ErrNoFileCRC if the archive has no (attributes) file, or it stores no CRC32 for the file, so callers can skip the
+// check.
+func (v MPQ) VerifyFileCRC(fileName string) error {
+	fileName = v.normalizeName(fileName)
+	hashEntry, err := v.getFileHashEntry(fileName)
+	if err != nil {
+		return err
+	}
+	expected, err := v.storedFileCRC(hashEntry.BlockIndex)
+	if err != nil {
+		return err
+	}
+	data, err := v.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	if actual := crc32.ChecksumIEEE(data); actual != expected {
+		return fmt.Errorf("crc32 of %s is %08X, expected %08X", fileName, actual, expected)
+	}
+	return nil
+}
+
+// storedFileCRC returns the CRC32 the (attributes) file stores for a block
+func (v MPQ) storedFileCRC(blockIndex uint32) (uint32, error) {
+	if !v.FileExists(attributesFileName) {
+		return 0, ErrNoFileCRC
+	}
+	data, err := v.ReadFile(attributesFileName)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 8 {
+		return 0, errors.New("attributes file is truncated")
+	}
+	flags := binary.LittleEndian.Uint32(data[4:8])
+	offset := 8 + (int(blockIndex) * 4)
+	if flags&attributesCRC32 == 0 || offset+4 > len(data) {
+		return 0, ErrNoFileCRC
+	}
+	result := binary.LittleEndian.Uint32(data[offset : offset+4])
+	if result == 0 {
+		// Blocks whose CRC32 was not computed, such as the attributes file itself, store 0
+		return 0, ErrNoFileCRC
+	}
+	return result, nil
+}
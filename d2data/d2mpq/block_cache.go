@@ -0,0 +1,98 @@
+package d2mpq
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+// DefaultBlockCacheLimit is the default number of bytes of decoded file blocks kept by the block cache
+const DefaultBlockCacheLimit = 32 * 1024 * 1024
+
+// blockCacheKey identifies a decoded file by the bytes stored in the archive, so identical files under different names
+// or in different archives share one entry. The stored bytes of encrypted files decrypt differently under different
+// keys, so the key is part of it. Entries can not go stale, as changed stored bytes give a different key.
+type blockCacheKey struct {
+	digest [sha256.Size]byte
+	seed   uint32
+	flags  FileFlag
+	size   uint32
+}
+
+// newBlockCacheKey returns the key of a file whose stored bytes are data
+func newBlockCacheKey(fileBlockData BlockTableEntry, data []byte) blockCacheKey {
+	key := blockCacheKey{
+		digest: sha256.Sum256(data),
+		flags:  fileBlockData.Flags,
+		size:   fileBlockData.UncompressedFileSize,
+	}
+	if fileBlockData.HasFlag(FileEncrypted) {
+		key.seed = fileBlockData.EncryptionSeed
+		if fileBlockData.HasFlag(FileFixKey) {
+			key.seed = (key.seed + fileBlockData.FilePosition) ^ fileBlockData.UncompressedFileSize
+		}
+	}
+	return key
+}
+
+// blockCache holds decoded files shared by all archives, so a file stored identically under several names or in
+// several archives is only decompressed once. Files are evicted oldest first once the total size goes past the limit.
+var blockCache = struct {
+	sync.Mutex
+	entries map[blockCacheKey][]byte
+	order   []blockCacheKey
+	size    int
+	limit   int
+}{
+	entries: make(map[blockCacheKey][]byte),
+	limit:   DefaultBlockCacheLimit,
+}
+
+// SetBlockCacheLimit sets the number of bytes of decoded file blocks that are kept. A limit of 0 disables the cache.
+func SetBlockCacheLimit(limit int) {
+	blockCache.Lock()
+	defer blockCache.Unlock()
+	blockCache.limit = limit
+	for blockCache.size > limit {
+		evictOldestBlock()
+	}
+}
+
+// ClearBlockCache drops all cached file blocks
+func ClearBlockCache() {
+	blockCache.Lock()
+	defer blockCache.Unlock()
+	blockCache.entries = make(map[blockCacheKey][]byte)
+	blockCache.order = nil
+	blockCache.size = 0
+}
+
+func getCachedBlock(key blockCacheKey) ([]byte, bool) {
+	blockCache.Lock()
+	defer blockCache.Unlock()
+	data, ok := blockCache.entries[key]
+	return data, ok
+}
+
+func cacheBlock(key blockCacheKey, data []byte) {
+	blockCache.Lock()
+	defer blockCache.Unlock()
+	if len(data) > blockCache.limit {
+		return
+	}
+	if _, ok := blockCache.entries[key]; ok {
+		return
+	}
+	for blockCache.size+len(data) > blockCache.limit {
+		evictOldestBlock()
+	}
+	blockCache.entries[key] = data
+	blockCache.order = append(blockCache.order, key)
+	blockCache.size += len(data)
+}
+
+func evictOldestBlock() {
+	key := blockCache.order[0]
+	blockCache.order = blockCache.order[1:]
+	blockCache.size -= len(blockCache.entries[key])
+	delete(blockCache.entries, key)
+}
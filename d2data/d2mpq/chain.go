@@ -0,0 +1,130 @@
+package d2mpq
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+)
+
+// Chain is an ordered list of archives that are searched for files. Archives earlier in the chain take precedence
+// over the ones after them, the same way patch archives override the base game archives.
+type Chain struct {
+	// Overlays are directories of loose files that are searched before any of the archives
+	Overlays []DirSource
+	Archives []*MPQ
+}
+
+// NewChain creates a search chain over the given archives, in order of precedence
+func NewChain(archives ...*MPQ) *Chain {
+	return &Chain{Archives: archives}
+}
+
+// FileExists returns true if any overlay or archive in the chain contains the file
+func (v *Chain) FileExists(fileName string) bool {
+	return v.findSource(fileName) != nil
+}
+
+// ReadFile reads a file from the first overlay or archive in the chain that contains it
+func (v *Chain) ReadFile(fileName string) ([]byte, error) {
+	source := v.findSource(fileName)
+	if source == nil {
+		return []byte{}, errors.New("file not found")
+	}
+	return source.ReadFile(fileName)
+}
+
+// ReadFilePreferring reads a file from the preferred archive if it contains the file, and otherwise from the first
+// archive in the chain that does. The preferred archive does not have to be part of the chain.
+func (v *Chain) ReadFilePreferring(fileName string, preferred *MPQ) ([]byte, error) {
+	if preferred != nil && preferred.FileExists(preferred.normalizeName(fileName)) {
+		return preferred.ReadFile(fileName)
+	}
+	return v.ReadFile(fileName)
+}
+
+// GetFileList returns the names of the files in all overlays and archives of the chain. Archives without a listfile
+// are skipped.
+func (v *Chain) GetFileList() ([]string, error) {
+	var (
+		filePaths []string
+		lastErr   error
+	)
+	found := false
+	seen := make(map[string]bool)
+	for _, overlay := range v.Overlays {
+		fileList, err := overlay.GetFileList()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		found = true
+		for _, filePath := range fileList {
+			key := normalizeFileName(filePath)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	for _, archive := range v.Archives {
+		fileList, err := archive.GetFileList()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		found = true
+		for _, filePath := range fileList {
+			key := archive.normalizeName(filePath)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			filePaths = append(filePaths, filePath)
+		}
+	}
+	if !found && lastErr != nil {
+		return nil, lastErr
+	}
+	return filePaths, nil
+}
+
+// FS returns a read-only fs.FS over the files of all archives in the chain
+func (v *Chain) FS() fs.FS {
+	return newArchiveFS(v)
+}
+
+func (v *Chain) fileSize(fileName string) (int64, error) {
+	source := v.findSource(fileName)
+	if source == nil {
+		return 0, errors.New("file not found")
+	}
+	return source.fileSize(fileName)
+}
+
+// findSource returns the first overlay or archive that contains the file, or nil if none does
+func (v *Chain) findSource(fileName string) fileSource {
+	for _, overlay := range v.Overlays {
+		if overlay.FileExists(fileName) {
+			return overlay
+		}
+	}
+	if archive := v.findArchive(fileName); archive != nil {
+		return archive
+	}
+	return nil
+}
+
+func (v *Chain) findArchive(fileName string) *MPQ {
+	for _, archive := range v.Archives {
+		if archive.FileExists(archive.normalizeName(fileName)) {
+			return archive
+		}
+	}
+	return nil
+}
+
+// normalizeListPath converts a listfile entry into a slash separated path, as used by io/fs
+func normalizeListPath(filePath string) string {
+	return strings.Trim(strings.ReplaceAll(filePath, `\`, "/"), "/")
+}
@@ -1,10 +1,34 @@
 package d2mpq
 
+import (
+	"encoding/binary"
+	"sync"
+)
+
 // CryptoBuffer contains the crypto bytes for filename hashing
 var CryptoBuffer [0x500]uint32
 
-// InitializeCryptoBuffer initializes the crypto buffer
+var cryptoBufferOnce sync.Once
+
+// InitializeCryptoBuffer initializes the crypto buffer. It is safe to call more than once, the table is only built
+// the first time.
 func InitializeCryptoBuffer() {
+	ensureCrypto()
+}
+
+// ensureCrypto builds the crypto buffer if it has not been built yet. Every function that reads CryptoBuffer calls it
+// first, so the table is ready even when the package is used before its callers initialize it.
+func ensureCrypto() {
+	cryptoBufferOnce.Do(buildCryptoBuffer)
+}
+
+// CryptoTable returns a copy of the initialized crypto table, for tools that want to verify hashes
+func CryptoTable() [0x500]uint32 {
+	ensureCrypto()
+	return CryptoBuffer
+}
+
+func buildCryptoBuffer() {
 	seed := uint32(0x00100001)
 	for index1 := 0; index1 < 0x100; index1++ {
 		index2 := index1
@@ -18,3 +42,17 @@ func InitializeCryptoBuffer() {
 		}
 	}
 }
+
+// EncryptBytes encrypts the data in place using the given seed. It is the inverse of decryptBytes.
+func EncryptBytes(data []byte, seed uint32) {
+	ensureCrypto()
+	seed2 := uint32(0xEEEEEEEE)
+	for i := 0; i < len(data)-3; i += 4 {
+		seed2 += CryptoBuffer[0x400+(seed&0xFF)]
+		plain := binary.LittleEndian.Uint32(data[i : i+4])
+		result := plain ^ (seed + seed2)
+		seed = ((^seed << 21) + 0x11111111) | (seed >> 11)
+		seed2 = plain + seed2 + (seed2 << 5) + 3
+		binary.LittleEndian.PutUint32(data[i:i+4], result)
+	}
+}
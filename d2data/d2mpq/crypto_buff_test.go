@@ -0,0 +1,34 @@
+package d2mpq
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestEncryptBytesRoundTrip(t *testing.T) {
+	data := []byte("The quick brown fox jumps over the lazy dog!")
+	original := make([]byte, len(data))
+	copy(original, data)
+	seed := hashString("(block table)", 3)
+	EncryptBytes(data, seed)
+	if bytes.Equal(data, original) {
+		t.Fatal("EncryptBytes did not alter the data")
+	}
+	decryptBytes(data, seed)
+	if !bytes.Equal(data, original) {
+		t.Fatalf("Expected %q after decryption, but got %q instead", original, data)
+	}
+}
+
+func TestEnsureCryptoRebuildsTable(t *testing.T) {
+	expected := CryptoTable()
+	CryptoBuffer = [0x500]uint32{}
+	cryptoBufferOnce = sync.Once{}
+	if hashString("(hash table)", 3) != 0xC3AF3770 {
+		t.Fatal("Expected hashString to rebuild the crypto table before hashing")
+	}
+	if CryptoBuffer != expected {
+		t.Fatal("Expected the rebuilt crypto table to match the original")
+	}
+}
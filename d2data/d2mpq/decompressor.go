@@ -0,0 +1,106 @@
+package d2mpq
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/OpenDiablo2/D2Shared/d2data/d2compression"
+)
+
+// Decompressor decompresses the data of a sector, without its leading compression mask byte. expectedLength is the
+// size of the sector once decompressed.
+type Decompressor func(data []byte, expectedLength int) ([]byte, error)
+
+// Compression methods, as bits of the mask byte that precedes every compressed sector. A sector compressed with
+// several methods has all their bits set. The built-in decompressors handle zlib, PKWare, ADPCM stereo, and Huffman
+// followed by ADPCM mono or stereo. Other combinations need a decompressor registered with RegisterDecompressor.
+const (
+	CompressionHuffman     byte = 0x01
+	CompressionZlib        byte = 0x02
+	CompressionPKWare      byte = 0x08
+	CompressionBzip2       byte = 0x10
+	CompressionSparse      byte = 0x20
+	CompressionADPCMMono   byte = 0x40
+	CompressionADPCMStereo byte = 0x80
+)
+
+var compressionNames = []struct {
+	mask byte
+	name string
+}{
+	{CompressionHuffman, "huffman"},
+	{CompressionZlib, "zlib"},
+	{CompressionPKWare, "pkware"},
+	{CompressionBzip2, "bzip2"},
+	{CompressionSparse, "sparse"},
+	{CompressionADPCMMono, "adpcm-mono"},
+	{CompressionADPCMStereo, "adpcm-stereo"},
+}
+
+// CompressionMask returns the names of the compression methods set in a mask byte, joined by "|", such as
+// "huffman|adpcm-stereo". Unknown bits are listed in hex, and a mask without any bits is "none".
+func CompressionMask(b byte) string {
+	if b == 0 {
+		return "none"
+	}
+	var names []string
+	for _, method := range compressionNames {
+		if b&method.mask != 0 {
+			names = append(names, method.name)
+			b &^= method.mask
+		}
+	}
+	if b != 0 {
+		names = append(names, fmt.Sprintf("0x%02X", b))
+	}
+	return strings.Join(names, "|")
+}
+
+var decompressorMutex = sync.RWMutex{}
+var decompressors = make(map[byte]Decompressor)
+
+func init() {
+	// ZLib/Deflate
+	RegisterDecompressor(CompressionZlib, func(data []byte, _ int) ([]byte, error) {
+		return deflate(data), nil
+	})
+	// PKLib/Implode
+	RegisterDecompressor(CompressionPKWare, func(data []byte, _ int) ([]byte, error) {
+		return pkDecompress(data), nil
+	})
+	// IMA ADPCM Stereo
+	RegisterDecompressor(CompressionADPCMStereo, func(data []byte, _ int) ([]byte, error) {
+		return d2compression.WavDecompress(data, 2), nil
+	})
+	// Huffman then IMA ADPCM Mono
+	RegisterDecompressor(CompressionHuffman|CompressionADPCMMono, func(data []byte, _ int) ([]byte, error) {
+		return huffmanWavDecompress(data, 1), nil
+	})
+	// Huffman then IMA ADPCM Stereo
+	RegisterDecompressor(CompressionHuffman|CompressionADPCMStereo, func(data []byte, _ int) ([]byte, error) {
+		return huffmanWavDecompress(data, 2), nil
+	})
+}
+
+// RegisterDecompressor registers the decompressor used for sectors with the given compression mask, replacing any
+// decompressor previously registered for it. The built-in methods are registered the same way.
+func RegisterDecompressor(mask byte, fn Decompressor) {
+	decompressorMutex.Lock()
+	defer decompressorMutex.Unlock()
+	decompressors[mask] = fn
+}
+
+func getDecompressor(mask byte) Decompressor {
+	decompressorMutex.RLock()
+	defer decompressorMutex.RUnlock()
+	return decompressors[mask]
+}
+
+func huffmanWavDecompress(data []byte, channelCount int) []byte {
+	sinput := d2compression.HuffmanDecompress(data)
+	sinput = d2compression.WavDecompress(sinput, channelCount)
+	tmp := make([]byte, len(sinput))
+	copy(tmp, sinput)
+	return tmp
+}
@@ -0,0 +1,35 @@
+package d2mpq
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRegisterDecompressor(t *testing.T) {
+	const mask = 0x04
+	defer func() {
+		decompressorMutex.Lock()
+		delete(decompressors, mask)
+		decompressorMutex.Unlock()
+	}()
+	RegisterDecompressor(mask, func(data []byte, expectedLength int) ([]byte, error) {
+		return bytes.Repeat(data, expectedLength/len(data)), nil
+	})
+	result := decompressMulti([]byte{mask, 'a', 'b'}, 6)
+	if string(result) != "ababab" {
+		t.Fatalf("Expected the registered decompressor to be used, got %q", result)
+	}
+}
+
+func TestCompressionMask(t *testing.T) {
+	for mask, expected := range map[byte]string{
+		0x00: "none",
+		0x02: "zlib",
+		0x81: "huffman|adpcm-stereo",
+		0x06: "zlib|0x04",
+	} {
+		if name := CompressionMask(mask); name != expected {
+			t.Fatalf("Expected %q for mask 0x%02X, got %q", expected, mask, name)
+		}
+	}
+}
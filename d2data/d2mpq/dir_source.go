@@ -0,0 +1,95 @@
+package d2mpq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirSource is a directory of loose files, such as the working copy of a mod. Added to the Overlays of a Chain, its
+// files shadow the archive files with the same name, so edited files are picked up without repacking the archives.
+// File names are normalized the same way as archive reads and matched regardless of case.
+type DirSource string
+
+// FileExists returns true if the directory contains the file
+func (v DirSource) FileExists(fileName string) bool {
+	filePath, err := v.resolve(fileName)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(filePath)
+	return err == nil && !info.IsDir()
+}
+
+// ReadFile reads a file from the directory
+func (v DirSource) ReadFile(fileName string) ([]byte, error) {
+	filePath, err := v.resolve(fileName)
+	if err != nil {
+		return []byte{}, err
+	}
+	return ioutil.ReadFile(filePath)
+}
+
+// GetFileList returns the names of the files in the directory and its subdirectories, in the backslash separated
+// form archives use
+func (v DirSource) GetFileList() ([]string, error) {
+	var filePaths []string
+	err := filepath.Walk(string(v), func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(string(v), filePath)
+		if err != nil {
+			return err
+		}
+		filePaths = append(filePaths, strings.ReplaceAll(filepath.ToSlash(relativePath), "/", `\`))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filePaths, nil
+}
+
+func (v DirSource) fileSize(fileName string) (int64, error) {
+	filePath, err := v.resolve(fileName)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// resolve finds the path of a file in the directory. Each part of the name is matched regardless of case, so names
+// work the same way on case sensitive file systems as they do in archives.
+func (v DirSource) resolve(fileName string) (string, error) {
+	result := string(v)
+	for _, part := range strings.Split(normalizeFileName(fileName), `\`) {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		entries, err := ioutil.ReadDir(result)
+		if err != nil {
+			return "", err
+		}
+		match := ""
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Name(), part) {
+				match = entry.Name()
+				break
+			}
+		}
+		if match == "" {
+			return "", os.ErrNotExist
+		}
+		result = filepath.Join(result, match)
+	}
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package d2mpq
+
+import "sync"
+
+// fileContentCache holds the content of the files read from an archive, by normalized name. MPQ methods have value
+// receivers, so the cache is shared through a pointer and guarded by its own lock, which lets many goroutines read
+// from the same archive.
+type fileContentCache struct {
+	sync.RWMutex
+	files map[string][]byte
+}
+
+func newFileContentCache() *fileContentCache {
+	return &fileContentCache{files: make(map[string][]byte)}
+}
+
+// get returns the cached content of the file, or nil if it is not cached. A nil cache holds nothing.
+func (v *fileContentCache) get(fileName string) []byte {
+	if v == nil {
+		return nil
+	}
+	v.RLock()
+	defer v.RUnlock()
+	return v.files[fileName]
+}
+
+func (v *fileContentCache) put(fileName string, data []byte) {
+	if v == nil {
+		return
+	}
+	v.Lock()
+	defer v.Unlock()
+	v.files[fileName] = data
+}
+
+func (v *fileContentCache) remove(fileName string) {
+	if v == nil {
+		return
+	}
+	v.Lock()
+	defer v.Unlock()
+	delete(v.files, fileName)
+}
+
+func (v *fileContentCache) clear() {
+	if v == nil {
+		return
+	}
+	v.Lock()
+	defer v.Unlock()
+	v.files = make(map[string][]byte)
+}
+
+// len returns the number of cached files
+func (v *fileContentCache) len() int {
+	if v == nil {
+		return 0
+	}
+	v.RLock()
+	defer v.RUnlock()
+	return len(v.files)
+}
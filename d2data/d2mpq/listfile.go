@@ -0,0 +1,51 @@
+package d2mpq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BuildListfile builds the content of a (listfile) naming the files. Names are written with backslashes, one per line
+// with CRLF line endings, the way the game archives store them. Empty names and names that differ only in case or
+// slashes from an earlier one are left out.
+func BuildListfile(names []string) []byte {
+	builder := strings.Builder{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.ReplaceAll(name, "/", `\`)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		builder.WriteString(name)
+		builder.WriteString("\r\n")
+	}
+	return []byte(builder.String())
+}
+
+// Repack writes a copy of the archive to destPath holding the named files and a listfile built from the names, so an
+// archive whose names were recovered becomes self-describing. When names is nil, the names GetFileList returns are
+// used, which includes the ones set by LoadNameIndex. The files are stored without compression, as Writer does, and
+// the (listfile) and (attributes) of the source archive are not copied. It fails if any of the files cannot be read.
+func Repack(src *MPQ, destPath string, names []string) error {
+	if names == nil {
+		fileList, err := src.GetFileList()
+		if err != nil {
+			return fmt.Errorf("unable to list the files: %v", err)
+		}
+		names = fileList
+	}
+	writer := NewWriter()
+	for _, fileName := range names {
+		if fileName == "" || fileName == listfileName || fileName == attributesFileName {
+			continue
+		}
+		data, err := src.ReadFile(fileName)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %v", fileName, err)
+		}
+		writer.AddFile(strings.ReplaceAll(fileName, "/", `\`), data)
+	}
+	return writer.WriteFile(destPath)
+}
@@ -0,0 +1,92 @@
+package d2mpq
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LoadErrors holds the errors of the archives LoadAll could not load, keyed by path
+type LoadErrors map[string]error
+
+func (v LoadErrors) Error() string {
+	paths := make([]string, 0, len(v))
+	for path := range v {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	messages := make([]string, len(paths))
+	for i, path := range paths {
+		messages[i] = fmt.Sprintf("%s: %v", path, v[path])
+	}
+	return fmt.Sprintf("unable to load %d archives: %s", len(v), strings.Join(messages, "; "))
+}
+
+// LoadAll loads the archives using up to parallelism workers, and returns them keyed by path. Archives already in the
+// package wide cache are reused, and newly loaded archives are added to it. An archive that fails to load does not
+// stop the others; its error is returned as part of a LoadErrors, along with the archives that did load.
+func LoadAll(paths []string, parallelism int) (map[string]*MPQ, error) {
+	ensureCrypto()
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	var (
+		resultMutex sync.Mutex
+		waitGroup   sync.WaitGroup
+	)
+	result := make(map[string]*MPQ, len(paths))
+	loadErrors := make(LoadErrors)
+	work := make(chan string)
+	for i := 0; i < parallelism; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for fileName := range work {
+				archive, err := loadCachedConcurrently(fileName)
+				resultMutex.Lock()
+				if err != nil {
+					loadErrors[fileName] = err
+				} else {
+					result[fileName] = archive
+				}
+				resultMutex.Unlock()
+			}
+		}()
+	}
+	for _, fileName := range paths {
+		work <- fileName
+	}
+	close(work)
+	waitGroup.Wait()
+	if len(loadErrors) > 0 {
+		return result, loadErrors
+	}
+	return result, nil
+}
+
+// loadCachedConcurrently loads an archive through the cache, like Load, but parses it without holding the cache lock
+// so several archives can be parsed at once. If another caller cached the same archive in the meantime, that archive
+// is used and the new one is closed.
+func loadCachedConcurrently(fileName string) (*MPQ, error) {
+	cacheKey := archiveCacheKey(fileName)
+	mpqMutex.Lock()
+	cached := mpqCache[cacheKey]
+	mpqMutex.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+	archive, err := openArchive(fileName)
+	if err != nil {
+		return nil, err
+	}
+	mpqMutex.Lock()
+	defer mpqMutex.Unlock()
+	if cached = mpqCache[cacheKey]; cached != nil {
+		archive.File.Close()
+		return cached, nil
+	}
+	archive.cacheKey = cacheKey
+	mpqCache[cacheKey] = archive
+	return archive, nil
+}
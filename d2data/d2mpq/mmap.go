@@ -0,0 +1,46 @@
+package d2mpq
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// errMmapUnsupported is returned by mapFile on platforms without mmap
+var errMmapUnsupported = errors.New("mmap is not supported on this platform")
+
+// mappedFile is an archive mapped into memory. Reads copy from the mapping, so they need no syscall. Reads hold the
+// read lock while they copy, and unmap takes the write lock, so the mapping is never released under a reader.
+type mappedFile struct {
+	mutex sync.RWMutex
+	data  []byte
+}
+
+// ReadAt implements io.ReaderAt over the mapping. Once the mapping is released, it returns os.ErrClosed.
+func (v *mappedFile) ReadAt(p []byte, off int64) (int, error) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	if v.data == nil {
+		return 0, os.ErrClosed
+	}
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= int64(len(v.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, v.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readerAt returns the source file data is read from, which is the mapping of the archive if it is memory-mapped
+func (v MPQ) readerAt() io.ReaderAt {
+	if v.mapping != nil {
+		return v.mapping
+	}
+	return v.File
+}
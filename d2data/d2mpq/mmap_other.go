@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package d2mpq
+
+import "os"
+
+// mapFile always fails, so archives are read from the file
+func mapFile(file *os.File) (*mappedFile, error) {
+	return nil, errMmapUnsupported
+}
+
+// unmap does nothing, as there are no mappings on this platform
+func (v *mappedFile) unmap() error {
+	return nil
+}
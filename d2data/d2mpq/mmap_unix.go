@@ -0,0 +1,42 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package d2mpq
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// mapFile maps the whole file read-only into memory
+func mapFile(file *os.File) (*mappedFile, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fileInfo.Size()
+	if size == 0 {
+		return nil, errors.New("cannot map an empty file")
+	}
+	if size > int64(maxInt) {
+		return nil, errors.New("file is too large to map on this platform")
+	}
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	return &mappedFile{data: data}, nil
+}
+
+// unmap releases the mapping once the reads in progress have finished
+func (v *mappedFile) unmap() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if v.data == nil {
+		return nil
+	}
+	data := v.data
+	v.data = nil
+	return syscall.Munmap(data)
+}
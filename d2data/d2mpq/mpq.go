@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -16,14 +18,28 @@ import (
 	"github.com/OpenDiablo2/D2Shared/d2common/d2resource"
 )
 
-// MPQ represents an MPQ archive
+// MPQ represents an MPQ archive. Files can be read from an archive by many goroutines at once. Methods that change
+// how names are looked up, such as ResolveNames, LoadNameIndex and SetLanguageCode, must finish before the archive is
+// shared, and Close must not be called while other goroutines still read from it.
 type MPQ struct {
 	FileName          string
 	File              *os.File
 	HashTableEntries  []HashTableEntry
 	BlockTableEntries []BlockTableEntry
 	Data              Data
-	fileCache         map[string][]byte
+	ExtendedData      ExtendedData
+	// NameNormalizer converts file names into the form stored in the archive before they are looked up. When it is
+	// nil, {LANG} is replaced with the language code, names are lowercased and forward slashes become backslashes.
+	NameNormalizer func(string) string
+	fileCache      *fileContentCache
+	archiveOffset  int64
+	userData       []byte
+	languageCode   string
+	nameIndex      map[string]uint32 // Block indices of the normalized listfile names, built by ResolveNames
+	cacheKey       string            // Key of the archive in the archive cache, if it is cached
+	mapping        *mappedFile       // Memory mapping of the archive, if it was loaded with MemoryMap
+	rawHashTable   []byte            // Decrypted hash table, kept for RawHashTable
+	rawBlockTable  []byte            // Decrypted block table, kept for RawBlockTable
 }
 
 // Data Represents a MPQ file
@@ -39,6 +55,27 @@ type Data struct {
 	BlockTableEntries uint32
 }
 
+// ExtendedData represents the fields appended to the MPQ header by format version 2
+type ExtendedData struct {
+	HiBlockTableOffset   uint64 // Offset of the table holding the high 16 bits of each file position
+	HashTableOffsetHigh  uint16
+	BlockTableOffsetHigh uint16
+}
+
+// extendedHeaderSize is the size of a format version 2 header
+const extendedHeaderSize = 44
+
+// UserDataHeader represents the optional header that precedes the MPQ header
+type UserDataHeader struct {
+	Magic              [4]byte
+	UserDataSize       uint32 // Maximum size of the user data
+	HeaderOffset       uint32 // Offset of the MPQ header, relative to the start of this header
+	UserDataHeaderSize uint32 // Size of the user data that follows this header
+}
+
+// ErrNoUserData is returned by UserData when the archive has no user data header
+var ErrNoUserData = errors.New("mpq has no user data")
+
 // HashTableEntry represents a hashed file entry in the MPQ file
 type HashTableEntry struct { // 16 bytes
 	NamePartA  uint32
@@ -69,7 +106,7 @@ const (
 	FileFixKey FileFlag = 0x00020000
 	// FilePatchFile - The file contains incremental patch for an existing file in base MPQ
 	FilePatchFile FileFlag = 0x00100000
-	// FileSingleUnit - Instead of being divided to 0x1000-bytes blocks, the file is stored as single unit
+	// FileSingleUnit - Instead of being divided into sectors, the file is stored as single unit
 	FileSingleUnit FileFlag = 0x01000000
 	// FileDeleteMarker - File is a deletion marker, indicating that the file no longer exists. This is used to allow patch
 	// archives to delete files present in lower-priority archives in the search chain. The file usually
@@ -88,8 +125,9 @@ type BlockTableEntry struct { // 16 bytes
 	UncompressedFileSize uint32
 	Flags                FileFlag
 	// Local Stuff...
-	FileName       string
-	EncryptionSeed uint32
+	FilePositionHigh uint16 // High 16 bits of the file position, read from the hi-block table
+	FileName         string
+	EncryptionSeed   uint32
 }
 
 // HasFlag returns true if the specified flag is present
@@ -97,20 +135,111 @@ func (v BlockTableEntry) HasFlag(flag FileFlag) bool {
 	return (v.Flags & flag) != 0
 }
 
+// position returns the full 64-bit position of the file relative to the MPQ header
+func (v BlockTableEntry) position() int64 {
+	return int64(v.FilePositionHigh)<<32 | int64(v.FilePosition)
+}
+
+// maxInt is the largest int, which is smaller than the largest file size on 32-bit platforms
+const maxInt = int(^uint(0) >> 1)
+
+// size returns the uncompressed size of the file as an int, or an error if it does not fit, as can happen for corrupt
+// sizes on 32-bit platforms
+func (v BlockTableEntry) size() (int, error) {
+	if uint64(v.UncompressedFileSize) > uint64(maxInt) {
+		return 0, fmt.Errorf("file size of %d bytes is too large for this platform", v.UncompressedFileSize)
+	}
+	return int(v.UncompressedFileSize), nil
+}
+
+// isStoredRaw returns true if the file is stored as-is, so its content can be read directly from the archive
+func (v BlockTableEntry) isStoredRaw() bool {
+	return !v.HasFlag(FileImplode | FileCompress | FileEncrypted | FilePatchFile)
+}
+
 var mpqMutex = sync.Mutex{}
 var mpqCache = make(map[string]*MPQ)
 
+// LoadOptions configures how an MPQ file is loaded
+type LoadOptions struct {
+	// NoCache skips the package wide archive cache. The archive is neither looked up in nor added to the cache, so
+	// the caller owns it and is responsible for closing it.
+	NoCache bool
+	// Verify checks the consistency of the archive tables with Verify, and fails the load if they are inconsistent
+	Verify bool
+	// Scan looks for the header at 512 byte boundaries, for archives appended to other files without a user data
+	// header
+	Scan bool
+	// MemoryMap maps the archive into memory, so file data is read from the mapping instead of with a syscall per
+	// read. Where mmap is not available, or the mapping fails, the archive is read from the file as usual.
+	MemoryMap bool
+}
+
 // Load loads an MPQ file and returns a MPQ structure
 func Load(fileName string) (*MPQ, error) {
+	return LoadWithOptions(fileName, LoadOptions{})
+}
+
+// LoadUncached loads an MPQ file without adding it to the package wide archive cache
+func LoadUncached(fileName string) (*MPQ, error) {
+	return LoadWithOptions(fileName, LoadOptions{NoCache: true})
+}
+
+// LoadVerified loads an MPQ file and rejects it if its tables are inconsistent. Load is permissive and accepts such
+// archives.
+func LoadVerified(fileName string) (*MPQ, error) {
+	return LoadWithOptions(fileName, LoadOptions{Verify: true})
+}
+
+// LoadScan loads an MPQ file whose header is not at the start of the file, such as a self-extracting archive. The
+// header is searched for at 512 byte boundaries within the first 4 MiB of the file.
+func LoadScan(fileName string) (*MPQ, error) {
+	return LoadWithOptions(fileName, LoadOptions{Scan: true})
+}
+
+// LoadWithOptions loads an MPQ file using the given options
+func LoadWithOptions(fileName string, options LoadOptions) (*MPQ, error) {
+	ensureCrypto()
+	if options.NoCache {
+		return openArchiveWithOptions(fileName, options)
+	}
+	cacheKey := archiveCacheKey(fileName)
 	mpqMutex.Lock()
 	defer mpqMutex.Unlock()
-	cached := mpqCache[fileName]
+	cached := mpqCache[cacheKey]
 	if cached != nil {
+		if options.Verify {
+			if err := cached.Verify(); err != nil {
+				return nil, err
+			}
+		}
 		return cached, nil
 	}
+	result, err := openArchiveWithOptions(fileName, options)
+	if err != nil {
+		return nil, err
+	}
+	result.cacheKey = cacheKey
+	mpqCache[cacheKey] = result
+	return result, nil
+}
+
+// Archives appended to other files without a user data header are found by scanning for the header at every
+// headerScanAlignment bytes, up to maxHeaderScanBoundaries boundaries into the file
+const (
+	headerScanAlignment     = 512
+	maxHeaderScanBoundaries = 8192
+)
+
+func openArchive(fileName string) (*MPQ, error) {
+	return openArchiveWithOptions(fileName, LoadOptions{})
+}
+
+// openArchiveWithOptions opens an archive, scanning for its header and verifying its tables if the options say so
+func openArchiveWithOptions(fileName string, options LoadOptions) (*MPQ, error) {
 	result := &MPQ{
 		FileName:  fileName,
-		fileCache: make(map[string][]byte),
+		fileCache: newFileContentCache(),
 	}
 	var file *os.File
 	var err error
@@ -123,19 +252,58 @@ func Load(fileName string) (*MPQ, error) {
 		return nil, err
 	}
 	result.File = file
+	if options.Scan {
+		if result.archiveOffset, err = findHeader(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if options.MemoryMap {
+		// The mapping is an optimization, so archives that cannot be mapped are still loaded
+		if mapping, err := mapFile(file); err == nil {
+			result.mapping = mapping
+		}
+	}
 	err = result.readHeader()
+	if err == nil && options.Verify {
+		err = result.Verify()
+	}
 	if err != nil {
+		result.closeFile()
 		return nil, err
 	}
-	mpqCache[fileName] = result
 	return result, nil
 }
 
+// findHeader returns the offset of the first MPQ header at an aligned position in the file
+func findHeader(file io.ReaderAt) (int64, error) {
+	var magic [4]byte
+	for i := int64(0); i < maxHeaderScanBoundaries; i++ {
+		offset := i * headerScanAlignment
+		if _, err := file.ReadAt(magic[:], offset); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, err
+		}
+		if string(magic[:]) == "MPQ\x1A" {
+			return offset, nil
+		}
+	}
+	return 0, errors.New("no mpq header found")
+}
+
 func openIgnoreCase(mpqPath string) (*os.File, error) {
+	return os.Open(resolveIgnoreCase(mpqPath))
+}
+
+// resolveIgnoreCase returns the path of the file on disk whose name matches the base name of mpqPath ignoring case.
+// The path is returned cleaned but otherwise unchanged if the file exists with the specified case, or if no file
+// matches.
+func resolveIgnoreCase(mpqPath string) string {
 	// First see if file exists with specified case
-	mpqFile, err := os.Open(mpqPath)
-	if err == nil {
-		return mpqFile, err
+	if _, err := os.Stat(mpqPath); err == nil {
+		return filepath.Clean(mpqPath)
 	}
 
 	mpqName := filepath.Base(mpqPath)
@@ -143,7 +311,7 @@ func openIgnoreCase(mpqPath string) (*os.File, error) {
 
 	files, err := ioutil.ReadDir(mpqDir)
 	if err != nil {
-		return nil, err
+		return filepath.Clean(mpqPath)
 	}
 
 	for _, file := range files {
@@ -153,11 +321,31 @@ func openIgnoreCase(mpqPath string) (*os.File, error) {
 		}
 	}
 
-	file, err := os.Open(path.Join(mpqDir, mpqName))
-	return file, err
+	return path.Join(mpqDir, mpqName)
+}
+
+// archiveCacheKey returns the key an archive is cached under. On Linux, where archives are opened ignoring case, this
+// is the path of the file on disk, so names that only differ in case share one archive.
+func archiveCacheKey(fileName string) string {
+	if runtime.GOOS == "linux" {
+		return resolveIgnoreCase(fileName)
+	}
+	return fileName
 }
 
 func (v *MPQ) readHeader() error {
+	var magic [4]byte
+	if _, err := v.File.ReadAt(magic[:], 0); err != nil {
+		return err
+	}
+	if string(magic[:]) == "MPQ\x1B" {
+		if err := v.readUserData(); err != nil {
+			return err
+		}
+	}
+	if _, err := v.File.Seek(v.archiveOffset, 0); err != nil {
+		return err
+	}
 	err := binary.Read(v.File, binary.LittleEndian, &v.Data)
 	if err != nil {
 		return err
@@ -165,22 +353,77 @@ func (v *MPQ) readHeader() error {
 	if string(v.Data.Magic[:]) != "MPQ\x1A" {
 		return errors.New("invalid mpq header")
 	}
-	v.loadHashTable()
-	v.loadBlockTable()
+	if v.Data.FormatVersion >= 1 && v.Data.HeaderSize >= extendedHeaderSize {
+		err = binary.Read(v.File, binary.LittleEndian, &v.ExtendedData)
+		if err != nil {
+			return err
+		}
+	}
+	if err = v.loadHashTable(); err != nil {
+		return err
+	}
+	if err = v.loadBlockTable(); err != nil {
+		return err
+	}
+	return v.loadHiBlockTable()
+}
+
+func (v *MPQ) readUserData() error {
+	header := UserDataHeader{}
+	err := binary.Read(io.NewSectionReader(v.File, 0, 16), binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+	if header.HeaderOffset < 16 || header.UserDataHeaderSize > header.HeaderOffset-16 {
+		return errors.New("invalid mpq user data header")
+	}
+	v.userData = make([]byte, header.UserDataHeaderSize)
+	if _, err = v.File.ReadAt(v.userData, 16); err != nil {
+		return err
+	}
+	v.archiveOffset = int64(header.HeaderOffset)
 	return nil
 }
 
-func (v *MPQ) loadHashTable() {
-	_, err := v.File.Seek(int64(v.Data.HashTableOffset), 0)
+// UserData returns the raw user data stored in front of the archive, or ErrNoUserData if there is none
+func (v *MPQ) UserData() ([]byte, error) {
+	if v.userData == nil {
+		return nil, ErrNoUserData
+	}
+	result := make([]byte, len(v.userData))
+	copy(result, v.userData)
+	return result, nil
+}
+
+// SectorSize returns the size of the sectors files are divided into, as given by the archive header
+func (v MPQ) SectorSize() int {
+	return 0x200 << v.Data.BlockSize
+}
+
+// filePosition converts a position relative to the MPQ header into an offset in the file
+func (v MPQ) filePosition(position int64) int64 {
+	return v.archiveOffset + position
+}
+
+// loadHashTable reads the hash table, which like the block table is only checked against the actual size of the file
+func (v *MPQ) loadHashTable() error {
+	offset := int64(v.ExtendedData.HashTableOffsetHigh)<<32 | int64(v.Data.HashTableOffset)
+	fileInfo, err := v.File.Stat()
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	tableSize := int64(v.Data.HashTableEntries) * 16
+	if v.filePosition(offset)+tableSize > fileInfo.Size() {
+		return fmt.Errorf("hash table of %d bytes at offset %d is past the end of the %d byte file",
+			tableSize, v.filePosition(offset), fileInfo.Size())
 	}
 	hashData := make([]uint32, v.Data.HashTableEntries*4)
-	err = binary.Read(v.File, binary.LittleEndian, &hashData)
+	err = binary.Read(io.NewSectionReader(v.File, v.filePosition(offset), tableSize), binary.LittleEndian, &hashData)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	decrypt(hashData, hashString("(hash table)", 3))
+	v.rawHashTable = tableBytes(hashData)
 	for i := uint32(0); i < v.Data.HashTableEntries; i++ {
 		v.HashTableEntries = append(v.HashTableEntries, HashTableEntry{
 			NamePartA: hashData[i*4],
@@ -191,19 +434,50 @@ func (v *MPQ) loadHashTable() {
 			BlockIndex: hashData[(i*4)+3],
 		})
 	}
+	return nil
+}
+
+// RawHashTable returns the decrypted bytes of the hash table, as read from the archive. It is meant for debugging and
+// for comparing other MPQ readers with this one; the parsed table is in HashTableEntries.
+func (v MPQ) RawHashTable() []byte {
+	return append([]byte(nil), v.rawHashTable...)
+}
+
+// RawBlockTable returns the decrypted bytes of the block table, as read from the archive. It is meant for debugging
+// and for comparing other MPQ readers with this one; the parsed table is in BlockTableEntries.
+func (v MPQ) RawBlockTable() []byte {
+	return append([]byte(nil), v.rawBlockTable...)
+}
+
+// tableBytes encodes the decrypted dwords of a table back into little endian bytes
+func tableBytes(table []uint32) []byte {
+	result := make([]byte, len(table)*4)
+	for i, dw := range table {
+		binary.LittleEndian.PutUint32(result[i*4:], dw)
+	}
+	return result
 }
 
-func (v *MPQ) loadBlockTable() {
-	_, err := v.File.Seek(int64(v.Data.BlockTableOffset), 0)
+// loadBlockTable reads the block table. ArchiveSize is understated in some protected archives, so the table is only
+// checked against the actual size of the file.
+func (v *MPQ) loadBlockTable() error {
+	offset := int64(v.ExtendedData.BlockTableOffsetHigh)<<32 | int64(v.Data.BlockTableOffset)
+	fileInfo, err := v.File.Stat()
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	tableSize := int64(v.Data.BlockTableEntries) * 16
+	if v.filePosition(offset)+tableSize > fileInfo.Size() {
+		return fmt.Errorf("block table of %d bytes at offset %d is past the end of the %d byte file",
+			tableSize, v.filePosition(offset), fileInfo.Size())
 	}
 	blockData := make([]uint32, v.Data.BlockTableEntries*4)
-	err = binary.Read(v.File, binary.LittleEndian, &blockData)
+	err = binary.Read(io.NewSectionReader(v.File, v.filePosition(offset), tableSize), binary.LittleEndian, &blockData)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 	decrypt(blockData, hashString("(block table)", 3))
+	v.rawBlockTable = tableBytes(blockData)
 	for i := uint32(0); i < v.Data.BlockTableEntries; i++ {
 		v.BlockTableEntries = append(v.BlockTableEntries, BlockTableEntry{
 			FilePosition:         blockData[(i * 4)],
@@ -212,9 +486,28 @@ func (v *MPQ) loadBlockTable() {
 			Flags:                FileFlag(blockData[(i*4)+3]),
 		})
 	}
+	return nil
+}
+
+// loadHiBlockTable reads the high 16 bits of every file position from the hi-block table, if the archive has one
+func (v *MPQ) loadHiBlockTable() error {
+	if v.ExtendedData.HiBlockTableOffset == 0 {
+		return nil
+	}
+	hiBlockData := make([]uint16, len(v.BlockTableEntries))
+	reader := io.NewSectionReader(v.File, v.filePosition(int64(v.ExtendedData.HiBlockTableOffset)), int64(len(hiBlockData)*2))
+	err := binary.Read(reader, binary.LittleEndian, &hiBlockData)
+	if err != nil {
+		return fmt.Errorf("unable to read hi-block table: %v", err)
+	}
+	for i := range v.BlockTableEntries {
+		v.BlockTableEntries[i].FilePositionHigh = hiBlockData[i]
+	}
+	return nil
 }
 
 func decrypt(data []uint32, seed uint32) {
+	ensureCrypto()
 	seed2 := uint32(0xeeeeeeee)
 
 	for i := 0; i < len(data); i++ {
@@ -229,6 +522,7 @@ func decrypt(data []uint32, seed uint32) {
 }
 
 func decryptBytes(data []byte, seed uint32) {
+	ensureCrypto()
 	seed2 := uint32(0xEEEEEEEE)
 	for i := 0; i < len(data)-3; i += 4 {
 		seed2 += CryptoBuffer[0x400+(seed&0xFF)]
@@ -245,6 +539,7 @@ func decryptBytes(data []byte, seed uint32) {
 }
 
 func hashString(key string, hashType uint32) uint32 {
+	ensureCrypto()
 
 	seed1 := uint32(0x7FED7FED)
 	seed2 := uint32(0xEEEEEEEE)
@@ -257,48 +552,175 @@ func hashString(key string, hashType uint32) uint32 {
 	return seed1
 }
 
-func (v MPQ) getFileHashEntry(fileName string) (HashTableEntry, error) {
+// FileNameHashes returns the hashes an archive stores for the file name. The name is normalized the same way as in
+// ReadFile. The table index is not reduced to a table size; the home slot of the name is tableIndex % tableSize.
+func FileNameHashes(name string) (a, b, tableIndex uint32) {
+	name = normalizeFileName(name)
+	return hashString(name, 1), hashString(name, 2), hashString(name, 0)
+}
+
+const (
+	// hashEntryEmpty is the BlockIndex of a hash table entry that has never been used. It ends a probe chain.
+	hashEntryEmpty = 0xFFFFFFFF
+	// hashEntryDeleted is the BlockIndex of a hash table entry whose file was deleted. Probing continues past it.
+	hashEntryDeleted = 0xFFFFFFFE
+)
+
+// forEachHashEntry calls fn with the index of every hash entry stored under the file name, following the probe chain
+// from the name's home slot until an empty entry is reached. Iteration stops early when fn returns false.
+func (v MPQ) forEachHashEntry(fileName string, fn func(idx int) bool) {
+	tableSize := uint32(len(v.HashTableEntries))
+	if tableSize == 0 {
+		return
+	}
 	hashA := hashString(fileName, 1)
 	hashB := hashString(fileName, 2)
-
-	for idx, hashEntry := range v.HashTableEntries {
+	start := hashString(fileName, 0) % tableSize
+	for i := uint32(0); i < tableSize; i++ {
+		idx := (start + i) % tableSize
+		hashEntry := v.HashTableEntries[idx]
+		if hashEntry.BlockIndex == hashEntryEmpty {
+			return
+		}
+		if hashEntry.BlockIndex == hashEntryDeleted {
+			continue
+		}
 		if hashEntry.NamePartA != hashA || hashEntry.NamePartB != hashB {
 			continue
 		}
+		if !fn(int(idx)) {
+			return
+		}
+	}
+}
+
+func (v MPQ) getFileHashEntry(fileName string) (HashTableEntry, error) {
+	result := -1
+	v.forEachHashEntry(fileName, func(idx int) bool {
+		result = idx
+		return false
+	})
+	if result < 0 {
+		return HashTableEntry{}, errors.New("file not found")
+	}
+	return v.HashTableEntries[result], nil
+}
 
-		return v.HashTableEntries[idx], nil
+// OrphanBlocks returns the indices of the blocks of existing files that no hash entry references. Such blocks can not
+// be found by name, which points to corruption or a stripped hash table.
+func (v MPQ) OrphanBlocks() []uint32 {
+	referenced := make([]bool, len(v.BlockTableEntries))
+	for _, hashEntry := range v.HashTableEntries {
+		if hashEntry.BlockIndex < uint32(len(referenced)) {
+			referenced[hashEntry.BlockIndex] = true
+		}
+	}
+	var result []uint32
+	for idx, blockEntry := range v.BlockTableEntries {
+		if !referenced[idx] && blockEntry.HasFlag(FileExists) {
+			result = append(result, uint32(idx))
+		}
 	}
-	return HashTableEntry{}, errors.New("file not found")
+	return result
+}
+
+// FileLocales returns the locales of all hash entries stored under the file name
+func (v MPQ) FileLocales(fileName string) []uint16 {
+	var locales []uint16
+	v.forEachHashEntry(v.normalizeName(fileName), func(idx int) bool {
+		locales = append(locales, v.HashTableEntries[idx].Locale)
+		return true
+	})
+	return locales
 }
 
 // GetFileBlockData gets a block table entry
 func (v MPQ) getFileBlockData(fileName string) (BlockTableEntry, error) {
 	fileEntry, err := v.getFileHashEntry(fileName)
-	if err != nil || fileEntry.BlockIndex >= uint32(len(v.BlockTableEntries)) {
+	if err != nil {
 		return BlockTableEntry{}, err
 	}
+	if fileEntry.BlockIndex >= uint32(len(v.BlockTableEntries)) {
+		return BlockTableEntry{}, fmt.Errorf("block index %d is out of range", fileEntry.BlockIndex)
+	}
 	return v.BlockTableEntries[fileEntry.BlockIndex], nil
 }
 
-// Close closes the MPQ file
+// Close closes the MPQ file and removes it from the archive cache, so the next Load opens it again. The cached
+// content of its files is dropped as well, so a repacked archive is read afresh.
 func (v *MPQ) Close() {
-	err := v.File.Close()
+	mpqMutex.Lock()
+	if mpqCache[v.cacheKey] == v {
+		delete(mpqCache, v.cacheKey)
+	}
+	mpqMutex.Unlock()
+	v.InvalidateAll()
+	err := v.closeFile()
 	if err != nil {
 		log.Panic(err)
 	}
 }
 
+// closeFile releases the memory mapping of the archive, if there is one, and closes the file. The mapping stays
+// attached to the archive, as copies of it may still be reading, and reads from it fail once it is released.
+func (v *MPQ) closeFile() error {
+	if v.mapping != nil {
+		if err := v.mapping.unmap(); err != nil {
+			v.File.Close()
+			return err
+		}
+	}
+	return v.File.Close()
+}
+
+// FileExists returns true if the archive contains the file. Once ResolveNames has built the name index, names from the
+// listfile are found with a map lookup, and only other names probe the hash table. Names are normalized the way
+// ReadFile does.
 func (v MPQ) FileExists(fileName string) bool {
+	fileName = v.normalizeName(fileName)
+	if _, ok := v.nameIndex[fileName]; ok {
+		return true
+	}
 	_, err := v.getFileHashEntry(fileName)
 	return err == nil
 }
 
+// normalizeFileName converts a file name into the form used to look it up in the archive, using the global language
+// code
+func normalizeFileName(fileName string) string {
+	return normalizeFileNameLang(fileName, d2resource.LanguageCode)
+}
+
+// normalizeFileNameLang converts a file name into the form used to look it up in the archive, replacing {LANG} with
+// the given language code
+func normalizeFileNameLang(fileName, languageCode string) string {
+	fileName = strings.ReplaceAll(fileName, "{LANG}", languageCode)
+	fileName = strings.ToLower(fileName)
+	return strings.ReplaceAll(fileName, `/`, "\\")
+}
+
+// normalizeName converts a file name using the archive's NameNormalizer, or the default normalization if it has none.
+// The default normalization uses the language code of the archive, falling back to the global one.
+func (v MPQ) normalizeName(fileName string) string {
+	if v.NameNormalizer != nil {
+		return v.NameNormalizer(fileName)
+	}
+	if v.languageCode != "" {
+		return normalizeFileNameLang(fileName, v.languageCode)
+	}
+	return normalizeFileName(fileName)
+}
+
+// SetLanguageCode sets the language code {LANG} is replaced with in the file names read from this archive. An empty
+// code falls back to d2resource.LanguageCode.
+func (v *MPQ) SetLanguageCode(code string) {
+	v.languageCode = code
+}
+
 // ReadFile reads a file from the MPQ and returns a memory stream
 func (v MPQ) ReadFile(fileName string) ([]byte, error) {
-	fileName = strings.ReplaceAll(fileName, "{LANG}", d2resource.LanguageCode)
-	fileName = strings.ToLower(fileName)
-	fileName = strings.ReplaceAll(fileName, `/`, "\\")
-	cached := v.fileCache[fileName]
+	fileName = v.normalizeName(fileName)
+	cached := v.fileCache.get(fileName)
 	if cached != nil {
 		return cached, nil
 	}
@@ -308,23 +730,200 @@ func (v MPQ) ReadFile(fileName string) ([]byte, error) {
 	}
 	fileBlockData.FileName = strings.ToLower(fileName)
 	fileBlockData.calculateEncryptionSeed()
-	mpqStream, err := CreateStream(v, fileBlockData, fileName)
+	// Files stored as they are read gain nothing from the block cache, as reading them is all the work there is
+	var blockKey *blockCacheKey
+	if !fileBlockData.isStoredRaw() && fileBlockData.UncompressedFileSize > 0 {
+		stored, err := v.readStored(fileBlockData)
+		if err != nil {
+			return []byte{}, err
+		}
+		key := newBlockCacheKey(fileBlockData, stored)
+		if cachedBlock, ok := getCachedBlock(key); ok {
+			v.fileCache.put(fileName, cachedBlock)
+			return cachedBlock, nil
+		}
+		blockKey = &key
+	}
+	size, err := fileBlockData.size()
 	if err != nil {
 		return []byte{}, err
 	}
-	buffer := make([]byte, fileBlockData.UncompressedFileSize)
-	mpqStream.Read(buffer, 0, fileBlockData.UncompressedFileSize)
-	v.fileCache[fileName] = buffer
+	buffer := make([]byte, size)
+	if err = v.readBlock(fileBlockData, fileName, buffer); err != nil {
+		return []byte{}, err
+	}
+	v.fileCache.put(fileName, buffer)
+	if blockKey != nil {
+		cacheBlock(*blockKey, buffer)
+	}
 	return buffer, nil
 }
 
-// ReadTextFile reads a file and returns it as a string
+// Invalidate drops the cached content of the file, so the next ReadFile reads it from the archive again. The tables
+// are only read when the archive is opened, so an archive that was repacked on disk must be closed and loaded again.
+// The block cache is keyed by the stored bytes of files, so it never returns stale content and is left as it is.
+func (v MPQ) Invalidate(fileName string) {
+	v.fileCache.remove(v.normalizeName(fileName))
+}
+
+// InvalidateAll drops the cached content of all files of the archive
+func (v MPQ) InvalidateAll() {
+	v.fileCache.clear()
+}
+
+// ReadRawFile returns the bytes of the file exactly as stored in the archive, CompressedFileSize bytes from its
+// position. Nothing is decrypted or decompressed, and the sector offset table of sectored files is included. The
+// result is not cached.
+func (v MPQ) ReadRawFile(fileName string) ([]byte, error) {
+	fileBlockData, err := v.getFileBlockData(v.normalizeName(fileName))
+	if err != nil {
+		return nil, err
+	}
+	return v.readStored(fileBlockData)
+}
+
+// readStored returns the CompressedFileSize bytes stored for the file
+func (v MPQ) readStored(fileBlockData BlockTableEntry) ([]byte, error) {
+	if uint64(fileBlockData.CompressedFileSize) > uint64(maxInt) {
+		return nil, fmt.Errorf("stored size of %d bytes is too large for this platform", fileBlockData.CompressedFileSize)
+	}
+	result := make([]byte, fileBlockData.CompressedFileSize)
+	if _, err := v.readerAt().ReadAt(result, v.filePosition(fileBlockData.position())); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReadFileInto reads a file from the MPQ into dst, and returns the size of the file. It returns an error if dst is
+// too small to hold the file. The file is neither read from nor added to the caches, so the caller can reuse dst.
+func (v MPQ) ReadFileInto(fileName string, dst []byte) (int, error) {
+	fileName = v.normalizeName(fileName)
+	fileBlockData, err := v.getFileBlockData(fileName)
+	if err != nil {
+		return 0, err
+	}
+	size, err := fileBlockData.size()
+	if err != nil {
+		return 0, err
+	}
+	if len(dst) < size {
+		return 0, fmt.Errorf("buffer of %d bytes is too small for %s, which is %d bytes", len(dst), fileName, size)
+	}
+	fileBlockData.FileName = strings.ToLower(fileName)
+	fileBlockData.calculateEncryptionSeed()
+	if err = v.readBlock(fileBlockData, fileName, dst[:size]); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// ReadFileAt reads len(p) bytes of the file starting at byte offset off, the way io.ReaderAt does. Only the sectors
+// overlapping the range are read and decompressed, so large files can be read in pieces. It returns io.EOF when the
+// range extends past the end of the file. Files stored as a single unit are decompressed as a whole.
+func (v MPQ) ReadFileAt(fileName string, off int64, p []byte) (int, error) {
+	fileName = v.normalizeName(fileName)
+	fileBlockData, err := v.getFileBlockData(fileName)
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	size := int64(fileBlockData.UncompressedFileSize)
+	if off >= size {
+		return 0, io.EOF
+	}
+	n := int64(len(p))
+	if off+n > size {
+		n = size - off
+	}
+	fileBlockData.FileName = strings.ToLower(fileName)
+	fileBlockData.calculateEncryptionSeed()
+	if fileBlockData.isStoredRaw() {
+		if _, err = v.readerAt().ReadAt(p[:n], v.filePosition(fileBlockData.position()+off)); err != nil {
+			return 0, err
+		}
+	} else {
+		mpqStream, err := CreateStream(v, fileBlockData, fileName)
+		if err != nil {
+			return 0, err
+		}
+		mpqStream.CurrentPosition = uint32(off)
+		n = int64(mpqStream.Read(p, 0, uint32(n)))
+		if mpqStream.readErr != nil {
+			return 0, mpqStream.readErr
+		}
+	}
+	if n < int64(len(p)) {
+		return int(n), io.EOF
+	}
+	return int(n), nil
+}
+
+// readBlock reads the content of a file into the buffer, which must be the size of the file
+func (v MPQ) readBlock(fileBlockData BlockTableEntry, fileName string, buffer []byte) error {
+	if len(buffer) == 0 {
+		// Empty files, such as deletion markers, have no sectors to read
+		return nil
+	}
+	if fileBlockData.isStoredRaw() {
+		return v.readRaw(fileBlockData, buffer)
+	}
+	return v.readStream(fileBlockData, fileName, buffer)
+}
+
+// readRaw reads a file that is stored without compression or encryption with a single read
+func (v MPQ) readRaw(fileBlockData BlockTableEntry, buffer []byte) error {
+	_, err := v.readerAt().ReadAt(buffer, v.filePosition(fileBlockData.position()))
+	return err
+}
+
+// readStream reads a file through the sector stream, decrypting and decompressing as needed
+func (v MPQ) readStream(fileBlockData BlockTableEntry, fileName string, buffer []byte) error {
+	mpqStream, err := CreateStream(v, fileBlockData, fileName)
+	if err != nil {
+		return err
+	}
+	mpqStream.Read(buffer, 0, fileBlockData.UncompressedFileSize)
+	return mpqStream.readErr
+}
+
+// fileSize returns the uncompressed size of a file in the MPQ
+func (v MPQ) fileSize(fileName string) (int64, error) {
+	fileBlockData, err := v.getFileBlockData(v.normalizeName(fileName))
+	if err != nil {
+		return 0, err
+	}
+	return int64(fileBlockData.UncompressedFileSize), nil
+}
+
+// FileSectorChecksums returns the stored CRC of every sector of a file. It returns an error if the file does not
+// store sector checksums.
+func (v MPQ) FileSectorChecksums(fileName string) ([]uint32, error) {
+	fileName = v.normalizeName(fileName)
+	fileBlockData, err := v.getFileBlockData(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if !fileBlockData.HasFlag(FileSectorCrc) || !fileBlockData.HasFlag(FileCompress|FileImplode) ||
+		fileBlockData.HasFlag(FileSingleUnit) {
+		return nil, errors.New("file has no sector checksums")
+	}
+	mpqStream, err := CreateStream(v, fileBlockData, fileName)
+	if err != nil {
+		return nil, err
+	}
+	return mpqStream.readSectorChecksums()
+}
+
+// ReadTextFile reads a file and returns it as a string, without a byte order mark or trailing null padding. Files
+// with a UTF-16 byte order mark are decoded to UTF-8.
 func (v MPQ) ReadTextFile(fileName string) (string, error) {
 	data, err := v.ReadFile(fileName)
 	if err != nil {
 		return "", err
 	}
-	return string(data), nil
+	return decodeText(data), nil
 }
 
 func (v *BlockTableEntry) calculateEncryptionSeed() {
@@ -336,10 +935,14 @@ func (v *BlockTableEntry) calculateEncryptionSeed() {
 	v.EncryptionSeed = (v.EncryptionSeed + v.FilePosition) ^ v.UncompressedFileSize
 }
 
-// GetFileList returns the list of files in this MPQ
+// GetFileList returns the list of files in this MPQ. Archives without a listfile return the blocks named by
+// LoadNameIndex instead, if there are any.
 func (v MPQ) GetFileList() ([]string, error) {
 	data, err := v.ReadFile("(listfile)")
 	if err != nil {
+		if filePaths := v.namedFiles(); len(filePaths) > 0 {
+			return filePaths, nil
+		}
 		return nil, err
 	}
 	raw := strings.TrimRight(string(data), "\x00")
@@ -351,3 +954,50 @@ func (v MPQ) GetFileList() ([]string, error) {
 	}
 	return filePaths, nil
 }
+
+// Glob returns the names in the file list that match the pattern, using path.Match semantics. Names and the pattern
+// are normalized before matching, so the pattern may use either backslashes or forward slashes and is not case
+// sensitive. As with path.Match, * does not match across path separators.
+func (v MPQ) Glob(pattern string) ([]string, error) {
+	pattern = globPath(v.normalizeName(pattern))
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	fileList, err := v.GetFileList()
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, fileName := range fileList {
+		if matched, _ := path.Match(pattern, globPath(v.normalizeName(fileName))); matched {
+			matches = append(matches, fileName)
+		}
+	}
+	return matches, nil
+}
+
+// globPath converts a normalized file name into the slash separated form path.Match expects
+func globPath(fileName string) string {
+	return strings.ReplaceAll(fileName, `\`, "/")
+}
+
+// ResolveNames sets the FileName of every block table entry that is named in the listfile, and builds the name index
+// FileExists uses
+func (v *MPQ) ResolveNames() error {
+	fileList, err := v.GetFileList()
+	if err != nil {
+		return err
+	}
+	nameIndex := make(map[string]uint32, len(fileList))
+	for _, fileName := range fileList {
+		normalized := v.normalizeName(fileName)
+		hashEntry, err := v.getFileHashEntry(normalized)
+		if err != nil || hashEntry.BlockIndex >= uint32(len(v.BlockTableEntries)) {
+			continue
+		}
+		v.BlockTableEntries[hashEntry.BlockIndex].FileName = fileName
+		nameIndex[normalized] = hashEntry.BlockIndex
+	}
+	v.nameIndex = nameIndex
+	return nil
+}
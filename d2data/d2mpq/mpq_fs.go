@@ -0,0 +1,232 @@
+package d2mpq
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileSource is an archive, or a chain of archives, whose files can be exposed as an fs.FS
+type fileSource interface {
+	ReadFile(fileName string) ([]byte, error)
+	GetFileList() ([]string, error)
+	fileSize(fileName string) (int64, error)
+}
+
+// FS returns a read-only fs.FS over the files of the archive. Paths use forward slashes and are matched regardless of
+// case. Directories are synthesized from the listfile.
+func (v *MPQ) FS() fs.FS {
+	return newArchiveFS(v)
+}
+
+// archiveFS implements fs.FS, fs.ReadFileFS and fs.ReadDirFS over a fileSource
+type archiveFS struct {
+	source    fileSource
+	indexOnce sync.Once
+	indexErr  error
+	dirs      map[string][]fs.DirEntry
+}
+
+func newArchiveFS(source fileSource) *archiveFS {
+	return &archiveFS{source: source}
+}
+
+// index builds the directory tree from the listfile the first time it is needed
+func (v *archiveFS) index() error {
+	v.indexOnce.Do(func() {
+		fileList, err := v.source.GetFileList()
+		if err != nil {
+			v.indexErr = err
+			return
+		}
+		v.dirs = map[string][]fs.DirEntry{".": {}}
+		seen := make(map[string]bool)
+		for _, filePath := range fileList {
+			filePath = normalizeListPath(filePath)
+			if !fs.ValidPath(filePath) || filePath == "." {
+				continue
+			}
+			parts := strings.Split(filePath, "/")
+			parentKey := "."
+			for i := range parts {
+				fullPath := strings.Join(parts[:i+1], "/")
+				key := strings.ToLower(fullPath)
+				isDir := i < len(parts)-1
+				if !seen[key] {
+					seen[key] = true
+					v.dirs[parentKey] = append(v.dirs[parentKey], &archiveDirEntry{
+						fsys:  v,
+						path:  fullPath,
+						isDir: isDir,
+					})
+					if isDir {
+						v.dirs[key] = []fs.DirEntry{}
+					}
+				}
+				parentKey = key
+			}
+		}
+		for _, entries := range v.dirs {
+			sort.Slice(entries, func(i, j int) bool {
+				return entries[i].Name() < entries[j].Name()
+			})
+		}
+	})
+	return v.indexErr
+}
+
+// Open implements fs.FS
+func (v *archiveFS) Open(name string) (fs.File, error) {
+	if !validFSPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := v.index(); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if entries, ok := v.dirs[strings.ToLower(name)]; ok {
+		return &archiveDir{
+			info:    archiveFileInfo{name: path.Base(name), isDir: true},
+			entries: entries,
+		}, nil
+	}
+	data, err := v.readFile("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFile{
+		info:   archiveFileInfo{name: path.Base(name), size: int64(len(data))},
+		Reader: bytes.NewReader(data),
+	}, nil
+}
+
+// ReadFile implements fs.ReadFileFS
+func (v *archiveFS) ReadFile(name string) ([]byte, error) {
+	if !validFSPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	return v.readFile("readfile", name)
+}
+
+// ReadDir implements fs.ReadDirFS
+func (v *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !validFSPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if err := v.index(); err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	entries, ok := v.dirs[strings.ToLower(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]fs.DirEntry(nil), entries...), nil
+}
+
+// validFSPath reports whether the name is a valid io/fs path. Backslashes are rejected as they are the archive's own
+// separator.
+func validFSPath(name string) bool {
+	return fs.ValidPath(name) && !strings.Contains(name, `\`)
+}
+
+// readFile returns a copy of the file data, as the archive cache must not be modified by callers
+func (v *archiveFS) readFile(op, name string) ([]byte, error) {
+	archiveName := strings.ReplaceAll(name, "/", `\`)
+	if _, err := v.source.fileSize(archiveName); err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	data, err := v.source.ReadFile(archiveName)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// archiveFileInfo implements fs.FileInfo
+type archiveFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (v archiveFileInfo) Name() string       { return v.name }
+func (v archiveFileInfo) Size() int64        { return v.size }
+func (v archiveFileInfo) ModTime() time.Time { return time.Time{} }
+func (v archiveFileInfo) IsDir() bool        { return v.isDir }
+func (v archiveFileInfo) Sys() interface{}   { return nil }
+
+func (v archiveFileInfo) Mode() fs.FileMode {
+	if v.isDir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// archiveDirEntry implements fs.DirEntry
+type archiveDirEntry struct {
+	fsys  *archiveFS
+	path  string
+	isDir bool
+}
+
+func (v *archiveDirEntry) Name() string { return path.Base(v.path) }
+func (v *archiveDirEntry) IsDir() bool  { return v.isDir }
+
+func (v *archiveDirEntry) Type() fs.FileMode {
+	if v.isDir {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (v *archiveDirEntry) Info() (fs.FileInfo, error) {
+	if v.isDir {
+		return archiveFileInfo{name: v.Name(), isDir: true}, nil
+	}
+	size, err := v.fsys.source.fileSize(strings.ReplaceAll(v.path, "/", `\`))
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: v.path, Err: fs.ErrNotExist}
+	}
+	return archiveFileInfo{name: v.Name(), size: size}, nil
+}
+
+// archiveFile implements fs.File, io.Seeker and io.ReaderAt over the content of a file
+type archiveFile struct {
+	*bytes.Reader
+	info archiveFileInfo
+}
+
+func (v *archiveFile) Stat() (fs.FileInfo, error) { return v.info, nil }
+func (v *archiveFile) Close() error               { return nil }
+
+// archiveDir implements fs.ReadDirFile over a synthesized directory
+type archiveDir struct {
+	info    archiveFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (v *archiveDir) Stat() (fs.FileInfo, error) { return v.info, nil }
+func (v *archiveDir) Close() error               { return nil }
+
+func (v *archiveDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: v.info.name, Err: errors.New("is a directory")}
+}
+
+func (v *archiveDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	remaining := len(v.entries) - v.offset
+	if count > 0 && remaining == 0 {
+		return nil, io.EOF
+	}
+	if count <= 0 || count > remaining {
+		count = remaining
+	}
+	result := append([]fs.DirEntry(nil), v.entries[v.offset:v.offset+count]...)
+	v.offset += count
+	return result, nil
+}
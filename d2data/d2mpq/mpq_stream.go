@@ -1,19 +1,17 @@
 package d2mpq
 
 import (
-	"bufio"
 	"bytes"
 	"compress/zlib"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
-	"errors"
 
 	"github.com/OpenDiablo2/D2Shared/d2helper"
 
 	"github.com/JoshVarga/blast"
-	"github.com/OpenDiablo2/D2Shared/d2data/d2compression"
 )
 
 // Stream represents a stream of data in an MPQ archive
@@ -27,6 +25,7 @@ type Stream struct {
 	CurrentData       []byte
 	CurrentBlockIndex uint32
 	BlockSize         uint32
+	readErr           error // The first error reading a sector from the archive, after which Read returns nothing
 }
 
 // CreateStream creates an MPQ stream
@@ -41,11 +40,16 @@ func CreateStream(mpq MPQ, blockTableEntry BlockTableEntry, fileName string) (*S
 	if result.BlockTableEntry.HasFlag(FileFixKey) {
 		result.EncryptionSeed = (result.EncryptionSeed + result.BlockTableEntry.FilePosition) ^ result.BlockTableEntry.UncompressedFileSize
 	}
-	result.BlockSize = 0x200 << result.MPQData.Data.BlockSize
+	result.BlockSize = uint32(result.MPQData.SectorSize())
 
 	if result.BlockTableEntry.HasFlag(FilePatchFile) {
 		log.Fatal("Patching is not supported")
 	}
+	if result.BlockTableEntry.HasFlag(FileCompress) && result.BlockTableEntry.HasFlag(FileImplode) {
+		// The flags are mutually exclusive, a file is either compressed with the methods given by the mask byte of each
+		// sector or imploded as a whole
+		return nil, errors.New("file has both the compress and implode flags set")
+	}
 
 	var err error
 	if (result.BlockTableEntry.HasFlag(FileCompress) || result.BlockTableEntry.HasFlag(FileImplode)) && !result.BlockTableEntry.HasFlag(FileSingleUnit) {
@@ -55,12 +59,16 @@ func CreateStream(mpq MPQ, blockTableEntry BlockTableEntry, fileName string) (*S
 }
 
 func (v *Stream) loadBlockOffsets() error {
-	blockPositionCount := ((v.BlockTableEntry.UncompressedFileSize + v.BlockSize - 1) / v.BlockSize) + 1
+	blockPositionCount := v.sectorCount() + 1
+	if v.BlockTableEntry.HasFlag(FileSectorCrc) {
+		// The offset table has an extra entry marking the end of the sector checksums
+		blockPositionCount++
+	}
 	v.BlockPositions = make([]uint32, blockPositionCount)
-	v.MPQData.File.Seek(int64(v.BlockTableEntry.FilePosition), 0)
-	reader := bufio.NewReader(v.MPQData.File)
 	bytes := make([]byte, blockPositionCount*4)
-	reader.Read(bytes)
+	if _, err := v.MPQData.readerAt().ReadAt(bytes, v.MPQData.filePosition(v.BlockTableEntry.position())); err != nil {
+		return err
+	}
 	for i := range v.BlockPositions {
 		idx := i * 4
 		v.BlockPositions[i] = binary.LittleEndian.Uint32(bytes[idx : idx+4])
@@ -81,6 +89,45 @@ func (v *Stream) loadBlockOffsets() error {
 	return nil
 }
 
+func (v *Stream) sectorCount() uint32 {
+	return (v.BlockTableEntry.UncompressedFileSize + v.BlockSize - 1) / v.BlockSize
+}
+
+// readSectorChecksums reads the CRC of every sector, which is stored after the last sector
+func (v *Stream) readSectorChecksums() ([]uint32, error) {
+	sectorCount := v.sectorCount()
+	if uint32(len(v.BlockPositions)) < sectorCount+2 {
+		return nil, errors.New("file has no sector checksums")
+	}
+	offset := v.BlockPositions[sectorCount]
+	if v.BlockPositions[sectorCount+1] < offset {
+		return nil, errors.New("invalid sector checksum table offsets")
+	}
+	data := make([]byte, v.BlockPositions[sectorCount+1]-offset)
+	_, err := v.MPQData.readerAt().ReadAt(data, v.MPQData.filePosition(v.BlockTableEntry.position()+int64(offset)))
+	if err != nil {
+		return nil, err
+	}
+	expectedLength := sectorCount * 4
+	if uint32(len(data)) < expectedLength {
+		if len(data) == 0 {
+			return nil, errors.New("sector checksum table is empty")
+		}
+		data, err = decompressSector(data, expectedLength)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if uint32(len(data)) < expectedLength {
+		return nil, fmt.Errorf("sector checksum table is truncated (%d of %d bytes)", len(data), expectedLength)
+	}
+	result := make([]uint32, sectorCount)
+	for i := range result {
+		result[i] = binary.LittleEndian.Uint32(data[i*4 : (i*4)+4])
+	}
+	return result, nil
+}
+
 func (v *Stream) Read(buffer []byte, offset, count uint32) uint32 {
 	if v.BlockTableEntry.HasFlag(FileSingleUnit) {
 		return v.readInternalSingleUnit(buffer, offset, count)
@@ -88,7 +135,7 @@ func (v *Stream) Read(buffer []byte, offset, count uint32) uint32 {
 	toRead := count
 	readTotal := uint32(0)
 	for toRead > 0 {
-		read := v.readInternal(buffer, offset, count)
+		read := v.readInternal(buffer, offset, toRead)
 		if read == 0 {
 			break
 		}
@@ -103,6 +150,9 @@ func (v *Stream) readInternalSingleUnit(buffer []byte, offset, count uint32) uin
 	if len(v.CurrentData) == 0 {
 		v.loadSingleUnit()
 	}
+	if v.readErr != nil {
+		return 0
+	}
 
 	bytesToCopy := d2helper.Min(uint32(len(v.CurrentData))-v.CurrentPosition, count)
 	copy(buffer[offset:offset+bytesToCopy], v.CurrentData[v.CurrentPosition:v.CurrentPosition+bytesToCopy])
@@ -133,12 +183,14 @@ func (v *Stream) bufferData() {
 }
 
 func (v *Stream) loadSingleUnit() {
-	fileData := make([]byte, v.BlockSize)
-	v.MPQData.File.Seek(int64(v.MPQData.Data.HeaderSize), 0)
-	//binary.Read(v.MPQData.File, binary.LittleEndian, &fileData)
-	reader := bufio.NewReader(v.MPQData.File)
-	reader.Read(fileData)
-	if v.BlockSize == v.BlockTableEntry.UncompressedFileSize {
+	// A single unit file is stored as one piece, so its size is not bound by the sector size
+	fileData := make([]byte, v.BlockTableEntry.CompressedFileSize)
+	_, err := v.MPQData.readerAt().ReadAt(fileData, v.MPQData.filePosition(v.BlockTableEntry.position()))
+	if err != nil {
+		v.readErr = err
+		return
+	}
+	if v.BlockTableEntry.CompressedFileSize == v.BlockTableEntry.UncompressedFileSize {
 		v.CurrentData = fileData
 		return
 	}
@@ -157,12 +209,12 @@ func (v *Stream) loadBlock(blockIndex, expectedLength uint32) []byte {
 		offset = blockIndex * v.BlockSize
 		toRead = expectedLength
 	}
-	offset += v.BlockTableEntry.FilePosition
 	data := make([]byte, toRead)
-	v.MPQData.File.Seek(int64(offset), 0)
-	//binary.Read(v.MPQData.File, binary.LittleEndian, &data)
-	reader := bufio.NewReader(v.MPQData.File)
-	reader.Read(data)
+	_, err := v.MPQData.readerAt().ReadAt(data, v.MPQData.filePosition(v.BlockTableEntry.position()+int64(offset)))
+	if err != nil {
+		v.readErr = err
+		return nil
+	}
 	if v.BlockTableEntry.HasFlag(FileEncrypted) && v.BlockTableEntry.UncompressedFileSize > 3 {
 		if v.EncryptionSeed == 0 {
 			panic("Unable to determine encryption key")
@@ -170,14 +222,14 @@ func (v *Stream) loadBlock(blockIndex, expectedLength uint32) []byte {
 
 		decryptBytes(data, blockIndex+v.EncryptionSeed)
 	}
+	// CreateStream rejects files with both flags set. Should one get here anyway, FileCompress takes precedence.
 	if v.BlockTableEntry.HasFlag(FileCompress) && (toRead != expectedLength) {
 		if !v.BlockTableEntry.HasFlag(FileSingleUnit) {
 			data = decompressMulti(data, expectedLength)
 		} else {
 			data = pkDecompress(data)
 		}
-	}
-	if v.BlockTableEntry.HasFlag(FileImplode) && (toRead != expectedLength) {
+	} else if v.BlockTableEntry.HasFlag(FileImplode) && (toRead != expectedLength) {
 		data = pkDecompress(data)
 	}
 
@@ -185,55 +237,21 @@ func (v *Stream) loadBlock(blockIndex, expectedLength uint32) []byte {
 }
 
 func decompressMulti(data []byte, expectedLength uint32) []byte {
-	copmressionType := data[0]
-	switch copmressionType {
-	case 1: // Huffman
-		panic("huffman decompression not supported")
-	case 2: // ZLib/Deflate
-		return deflate(data[1:])
-	case 8: // PKLib/Impode
-		return pkDecompress(data[1:])
-	case 0x10: // BZip2
-		panic("bzip2 decompression not supported")
-	case 0x80: // IMA ADPCM Stereo
-		return d2compression.WavDecompress(data[1:], 2)
-		//return MpqWavCompression.Decompress(sinput, 2);
-		//panic("ima adpcm sterio decompression not supported")
-	case 0x40: // IMA ADPCM Mono
-		//return MpqWavCompression.Decompress(sinput, 1)
-		panic("mpq wav decompression not supported")
-	case 0x12:
-		panic("lzma decompression not supported")
-	// Combos
-	case 0x22:
-		// TODO: sparse then zlib
-		panic("sparse decompression + deflate decompression not supported")
-	case 0x30:
-		// TODO: sparse then bzip2
-		panic("sparse decompression + bzip2 decompression not supported")
-	case 0x41:
-		sinput := d2compression.HuffmanDecompress(data[1:])
-		sinput = d2compression.WavDecompress(sinput, 1)
-		tmp := make([]byte, len(sinput))
-		copy(tmp, sinput)
-		return tmp
-	case 0x48:
-		//byte[] result = PKDecompress(sinput, outputLength);
-		//return MpqWavCompression.Decompress(new MemoryStream(result), 1);
-		panic("pk + mpqwav decompression not supported")
-	case 0x81:
-		sinput := d2compression.HuffmanDecompress(data[1:])
-		sinput = d2compression.WavDecompress(sinput, 2)
-		tmp := make([]byte, len(sinput))
-		copy(tmp, sinput)
-		return tmp
-	case 0x88:
-		//byte[] result = PKDecompress(sinput, outputLength);
-		//return MpqWavCompression.Decompress(new MemoryStream(result), 2);
-		panic("pk + wav decompression not supported")
-	default:
-		panic(fmt.Sprintf("decompression not supported for unknown compression type %X", copmressionType))
+	result, err := decompressSector(data, expectedLength)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// decompressSector decompresses a sector using the method given by its leading compression mask byte
+func decompressSector(data []byte, expectedLength uint32) ([]byte, error) {
+	compressionType := data[0]
+	decompressor := getDecompressor(compressionType)
+	if decompressor == nil {
+		return nil, fmt.Errorf("decompression not supported for unknown compression type %X", compressionType)
 	}
+	return decompressor(data[1:], int(expectedLength))
 }
 
 func deflate(data []byte) []byte {
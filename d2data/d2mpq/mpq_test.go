@@ -0,0 +1,1456 @@
+package d2mpq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// writeTestMPQ writes an archive holding the given files stored without compression to a new temporary directory and
+// returns its path
+func writeTestMPQ(t *testing.T, files map[string][]byte) string {
+	return writeTestArchive(t, buildTestMPQ(files))
+}
+
+// testArchiveOptions configures the layout of a test archive
+type testArchiveOptions struct {
+	formatVersion uint16 // Version 1 archives get an extended header and a hi-block table
+	blockSize     uint16 // The sector size is 0x200 << blockSize
+	sectors       bool   // Store the files in sectors with an offset table, rather than as a single piece
+	archiveSize   uint32 // Archive size stored in the header, which is the actual size when 0
+}
+
+// buildTestMPQ builds an archive holding the given files stored without compression
+func buildTestMPQ(files map[string][]byte) []byte {
+	return buildTestMPQWithOptions(files, testArchiveOptions{blockSize: 3})
+}
+
+// buildTestMPQWithOptions builds an archive holding the given files stored without compression, using the given
+// layout
+func buildTestMPQWithOptions(files map[string][]byte, options testArchiveOptions) []byte {
+	formatVersion := options.formatVersion
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hashTableSize := uint32(16)
+	for hashTableSize < uint32(len(names))*2 {
+		hashTableSize *= 2
+	}
+	hashTable := make([]uint32, hashTableSize*4)
+	for i := range hashTable {
+		hashTable[i] = 0xFFFFFFFF
+	}
+	blockTable := make([]uint32, len(names)*4)
+
+	content := new(bytes.Buffer)
+	headerSize := uint32(32)
+	if formatVersion >= 1 {
+		headerSize = extendedHeaderSize
+	}
+	for blockIndex, name := range names {
+		data := files[name]
+		flags := FileExists
+		if options.sectors && len(data) > 0 {
+			data = encodeTestSectors(data, 0x200<<options.blockSize)
+			flags |= FileCompress
+		}
+		blockTable[blockIndex*4] = headerSize + uint32(content.Len())
+		blockTable[(blockIndex*4)+1] = uint32(len(data))
+		blockTable[(blockIndex*4)+2] = uint32(len(files[name]))
+		blockTable[(blockIndex*4)+3] = uint32(flags)
+		content.Write(data)
+
+		hashIndex := hashString(name, 0) & (hashTableSize - 1)
+		for hashTable[(hashIndex*4)+3] != 0xFFFFFFFF {
+			hashIndex = (hashIndex + 1) & (hashTableSize - 1)
+		}
+		hashTable[hashIndex*4] = hashString(name, 1)
+		hashTable[(hashIndex*4)+1] = hashString(name, 2)
+		hashTable[(hashIndex*4)+2] = 0
+		hashTable[(hashIndex*4)+3] = uint32(blockIndex)
+	}
+
+	hashTableOffset := headerSize + uint32(content.Len())
+	blockTableOffset := hashTableOffset + (hashTableSize * 16)
+	writeTable(content, hashTable, hashString("(hash table)", 3))
+	writeTable(content, blockTable, hashString("(block table)", 3))
+	hiBlockTableOffset := headerSize + uint32(content.Len())
+	if formatVersion >= 1 {
+		content.Write(make([]byte, len(names)*2))
+	}
+
+	archiveSize := options.archiveSize
+	if archiveSize == 0 {
+		archiveSize = headerSize + uint32(content.Len())
+	}
+	archive := new(bytes.Buffer)
+	binary.Write(archive, binary.LittleEndian, Data{
+		Magic:             [4]byte{'M', 'P', 'Q', 0x1A},
+		HeaderSize:        headerSize,
+		ArchiveSize:       archiveSize,
+		FormatVersion:     formatVersion,
+		BlockSize:         options.blockSize,
+		HashTableOffset:   hashTableOffset,
+		BlockTableOffset:  blockTableOffset,
+		HashTableEntries:  hashTableSize,
+		BlockTableEntries: uint32(len(names)),
+	})
+	if formatVersion >= 1 {
+		binary.Write(archive, binary.LittleEndian, ExtendedData{HiBlockTableOffset: uint64(hiBlockTableOffset)})
+	}
+	archive.Write(content.Bytes())
+	return archive.Bytes()
+}
+
+// encodeTestSectors prefixes the data with a sector offset table. The sectors are stored uncompressed, which the
+// reader detects from their size.
+func encodeTestSectors(data []byte, sectorSize int) []byte {
+	sectorCount := (len(data) + sectorSize - 1) / sectorSize
+	offsets := make([]byte, (sectorCount+1)*4)
+	for i := 0; i <= sectorCount; i++ {
+		end := i * sectorSize
+		if end > len(data) {
+			end = len(data)
+		}
+		binary.LittleEndian.PutUint32(offsets[i*4:], uint32(len(offsets)+end))
+	}
+	return append(offsets, data...)
+}
+
+// writeTestArchive writes the archive data to a new temporary directory and returns its path
+func writeTestArchive(t *testing.T, data []byte) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "d2mpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(dir, "test.mpq")
+	if err := ioutil.WriteFile(fileName, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func writeTable(w *bytes.Buffer, table []uint32, seed uint32) {
+	w.Write(encryptTable(table, seed))
+}
+
+func TestReadFileRawMatchesStream(t *testing.T) {
+	large := make([]byte, 0x2345)
+	for i := range large {
+		large[i] = byte(i * 7)
+	}
+	files := map[string][]byte{
+		`data\global\excel\small.txt`: []byte("Name\tValue\r\nfoo\t1\r\n"),
+		`data\global\large.bin`:       large,
+	}
+	fileName := writeTestMPQ(t, files)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	for name, expected := range files {
+		blockData, err := mpq.getFileBlockData(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !blockData.isStoredRaw() {
+			t.Fatalf("Expected %s to be stored raw", name)
+		}
+		raw := make([]byte, blockData.UncompressedFileSize)
+		if err := mpq.readRaw(blockData, raw); err != nil {
+			t.Fatal(err)
+		}
+		streamed := make([]byte, blockData.UncompressedFileSize)
+		if err := mpq.readStream(blockData, name, streamed); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw, streamed) || !bytes.Equal(raw, expected) {
+			t.Fatalf("Raw and streamed reads of %s do not match the stored content", name)
+		}
+		data, err := mpq.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("ReadFile returned unexpected content for %s", name)
+		}
+	}
+}
+
+func TestFS(t *testing.T) {
+	files := map[string][]byte{
+		`data\global\excel\levels.txt`:     []byte("Name\tId\r\n"),
+		`data\global\palette\act1\pal.dat`: make([]byte, 768),
+		`data\local\font\font8.tbl`:        []byte("font"),
+	}
+	var listfile bytes.Buffer
+	for name := range files {
+		listfile.WriteString(name + "\r\n")
+	}
+	files["(listfile)"] = listfile.Bytes()
+	fileName := writeTestMPQ(t, files)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	err = fstest.TestFS(NewChain(mpq).FS(),
+		"data/global/excel/levels.txt", "data/global/palette/act1/pal.dat", "data/local/font/font8.tbl")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserData(t *testing.T) {
+	files := map[string][]byte{`data\global\test.txt`: []byte("test")}
+	fileName := writeTestMPQ(t, files)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if _, err := mpq.UserData(); err != ErrNoUserData {
+		t.Fatalf("Expected ErrNoUserData but got %v instead", err)
+	}
+
+	userData := []byte("MyMod v1.2")
+	archive := new(bytes.Buffer)
+	binary.Write(archive, binary.LittleEndian, UserDataHeader{
+		Magic:              [4]byte{'M', 'P', 'Q', 0x1B},
+		UserDataSize:       512 - 16,
+		HeaderOffset:       512,
+		UserDataHeaderSize: uint32(len(userData)),
+	})
+	archive.Write(userData)
+	archive.Write(make([]byte, 512-archive.Len()))
+	archive.Write(buildTestMPQ(files))
+	fileName = writeTestArchive(t, archive.Bytes())
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err = Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	data, err := mpq.UserData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, userData) {
+		t.Fatalf("Expected user data %q but got %q instead", userData, data)
+	}
+	content, err := mpq.ReadFile(`data\global\test.txt`)
+	if err != nil || string(content) != "test" {
+		t.Fatalf("Expected to read the file after the user data, got %q (%v)", content, err)
+	}
+}
+
+func TestReadEmptyFile(t *testing.T) {
+	fileName := writeTestMPQ(t, map[string][]byte{`data\global\empty.txt`: {}})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	data, err := mpq.ReadFile(`data\global\empty.txt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data == nil || len(data) != 0 {
+		t.Fatalf("Expected an empty, non-nil slice but got %v", data)
+	}
+}
+
+func TestReloadAfterClose(t *testing.T) {
+	fileName := writeTestMPQ(t, map[string][]byte{`data\global\test.txt`: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpq.Close()
+	mpq, err = Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	data, err := mpq.ReadFile(`data\global\test.txt`)
+	if err != nil || string(data) != "test" {
+		t.Fatalf("Expected to read the file after reloading, got %q (%v)", data, err)
+	}
+}
+
+func TestHashEntrySentinels(t *testing.T) {
+	const name = `data\global\test.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	tableSize := uint32(len(mpq.HashTableEntries))
+	home := hashString(name, 0) % tableSize
+	entry := mpq.HashTableEntries[home]
+
+	// A deleted entry with the same name in the home slot is skipped, and the probe continues to the next slot
+	mpq.HashTableEntries[(home+1)%tableSize] = entry
+	mpq.HashTableEntries[home].BlockIndex = hashEntryDeleted
+	found, err := mpq.getFileHashEntry(name)
+	if err != nil || found.BlockIndex != entry.BlockIndex {
+		t.Fatalf("Expected the probe to skip the deleted entry, got %+v (%v)", found, err)
+	}
+
+	// An empty entry ends the probe chain
+	mpq.HashTableEntries[home].BlockIndex = hashEntryEmpty
+	if mpq.FileExists(name) {
+		t.Fatal("Expected the probe to stop at the empty entry")
+	}
+}
+
+func TestHiBlockTable(t *testing.T) {
+	const name = `data\global\test.txt`
+	fileName := writeTestArchive(t, buildTestMPQWithOptions(map[string][]byte{name: []byte("test")},
+		testArchiveOptions{formatVersion: 1, blockSize: 3}))
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if mpq.ExtendedData.HiBlockTableOffset == 0 {
+		t.Fatal("Expected the extended header to be read")
+	}
+	data, err := mpq.ReadFile(name)
+	if err != nil || string(data) != "test" {
+		t.Fatalf("Expected to read the file from a version 2 archive, got %q (%v)", data, err)
+	}
+
+	entry := BlockTableEntry{FilePosition: 0x10, FilePositionHigh: 1}
+	if entry.position() != 0x100000010 {
+		t.Fatalf("Expected position 0x100000010 but got %#x instead", entry.position())
+	}
+}
+
+func TestFileNameHashes(t *testing.T) {
+	const name = `data\global\test.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	a, b, tableIndex := FileNameHashes("DATA/Global/Test.txt")
+	entry := mpq.HashTableEntries[tableIndex%uint32(len(mpq.HashTableEntries))]
+	if entry.NamePartA != a || entry.NamePartB != b {
+		t.Fatalf("Expected the home slot to hold hashes %#x, %#x but got %#x, %#x instead",
+			a, b, entry.NamePartA, entry.NamePartB)
+	}
+}
+
+func TestChainReadFilePreferring(t *testing.T) {
+	baseName := writeTestMPQ(t, map[string][]byte{`data\a.txt`: []byte("base a"), `data\b.txt`: []byte("base b")})
+	defer os.RemoveAll(filepath.Dir(baseName))
+	modName := writeTestMPQ(t, map[string][]byte{`data\a.txt`: []byte("mod a")})
+	defer os.RemoveAll(filepath.Dir(modName))
+	base, err := LoadUncached(baseName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close()
+	mod, err := LoadUncached(modName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mod.Close()
+	chain := NewChain(base, mod)
+	for name, expected := range map[string]string{`data\a.txt`: "mod a", `data\b.txt`: "base b"} {
+		data, err := chain.ReadFilePreferring(name, mod)
+		if err != nil || string(data) != expected {
+			t.Fatalf("Expected %q for %s but got %q (%v)", expected, name, data, err)
+		}
+	}
+}
+
+func TestSectorSize(t *testing.T) {
+	const name = `data\global\test.bin`
+	content := make([]byte, 1200)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	fileName := writeTestArchive(t, buildTestMPQWithOptions(map[string][]byte{name: content},
+		testArchiveOptions{blockSize: 0, sectors: true}))
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if mpq.SectorSize() != 512 {
+		t.Fatalf("Expected a sector size of 512 but got %d instead", mpq.SectorSize())
+	}
+	data, err := mpq.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatal("Expected the file read across 512 byte sectors to match its content")
+	}
+}
+
+func TestNameNormalizer(t *testing.T) {
+	const name = "data/global/test.txt"
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if _, err := mpq.ReadFile(name); err == nil {
+		t.Fatal("Expected the default normalization to look up the name with backslashes")
+	}
+	mpq.NameNormalizer = strings.ToLower
+	data, err := mpq.ReadFile("Data/Global/Test.txt")
+	if err != nil || string(data) != "test" {
+		t.Fatalf("Expected to read the file using the custom normalizer, got %q (%v)", data, err)
+	}
+}
+
+func TestConflictingCompressionFlags(t *testing.T) {
+	entry := BlockTableEntry{UncompressedFileSize: 16, Flags: FileExists | FileCompress | FileImplode}
+	if _, err := CreateStream(MPQ{}, entry, "test.txt"); err == nil {
+		t.Fatal("Expected an error for a file that is both compressed and imploded")
+	}
+}
+
+func TestReadFileInto(t *testing.T) {
+	const name = `data\global\test.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if _, err := mpq.ReadFileInto(name, make([]byte, 3)); err == nil {
+		t.Fatal("Expected an error when the buffer is too small")
+	}
+	buffer := make([]byte, 16)
+	n, err := mpq.ReadFileInto(name, buffer)
+	if err != nil || string(buffer[:n]) != "test" {
+		t.Fatalf("Expected to read the file into the buffer, got %q (%v)", buffer[:n], err)
+	}
+	if mpq.fileCache.len() != 0 {
+		t.Fatal("Expected ReadFileInto to skip the file cache")
+	}
+}
+
+func TestReadTextFile(t *testing.T) {
+	const name = `data\global\excel\test.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("\xEF\xBB\xBFName\tValue\r\n\x00\x00\x00")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	text, err := mpq.ReadTextFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Name\tValue\r\n" {
+		t.Fatalf("Expected the BOM and null padding to be trimmed, got %q", text)
+	}
+}
+
+func TestReadTextFileUTF16(t *testing.T) {
+	const name = `data\local\lng\kor\string.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: {0xFF, 0xFE, 0x5C, 0xD5, 0x00, 0xAE, 0x00, 0x00}})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	text, err := mpq.ReadTextFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "\uD55C\uAE00" {
+		t.Fatalf("Expected the UTF-16 text to be decoded, got %q", text)
+	}
+}
+
+func TestUnderstatedArchiveSize(t *testing.T) {
+	const name = `data\global\test.txt`
+	data := buildTestMPQWithOptions(map[string][]byte{name: []byte("test")},
+		testArchiveOptions{blockSize: 3, archiveSize: 32})
+	fileName := writeTestArchive(t, data)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := mpq.ReadFile(name)
+	mpq.Close()
+	if err != nil || string(content) != "test" {
+		t.Fatalf("Expected to read the file despite the wrong archive size, got %q (%v)", content, err)
+	}
+
+	fileName = writeTestArchive(t, data[:len(data)-8])
+	defer os.RemoveAll(filepath.Dir(fileName))
+	if _, err := LoadUncached(fileName); err == nil {
+		t.Fatal("Expected an error for a block table past the end of the file")
+	}
+}
+
+func TestChainOverlay(t *testing.T) {
+	fileName := writeTestMPQ(t, map[string][]byte{`data\global\a.txt`: []byte("packed a"), `data\global\b.txt`: []byte("packed b")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	dir, err := ioutil.TempDir("", "d2mpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "Data", "Global"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "Data", "Global", "A.txt"), []byte("loose a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chain := NewChain(mpq)
+	chain.Overlays = []DirSource{DirSource(dir)}
+	for name, expected := range map[string]string{`data\global\a.txt`: "loose a", "data/global/b.txt": "packed b"} {
+		data, err := chain.ReadFile(name)
+		if err != nil || string(data) != expected {
+			t.Fatalf("Expected %q for %s but got %q (%v)", expected, name, data, err)
+		}
+	}
+}
+
+func TestLoadAll(t *testing.T) {
+	var paths []string
+	for i := 0; i < 3; i++ {
+		fileName := writeTestMPQ(t, map[string][]byte{`data\global\test.txt`: []byte("test")})
+		defer os.RemoveAll(filepath.Dir(fileName))
+		paths = append(paths, fileName)
+	}
+	cached, err := Load(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(filepath.Dir(paths[0]), "missing.mpq")
+	archives, err := LoadAll(append(paths, missing), 2)
+	for _, archive := range archives {
+		defer archive.Close()
+	}
+	loadErrors, ok := err.(LoadErrors)
+	if !ok || len(loadErrors) != 1 || loadErrors[missing] == nil {
+		t.Fatalf("Expected only the missing archive to fail, got %v", err)
+	}
+	if len(archives) != 3 || archives[paths[0]] != cached {
+		t.Fatalf("Expected the three archives to load and the cached one to be reused, got %v", archives)
+	}
+}
+
+func TestVerifyFileCRC(t *testing.T) {
+	const name = `data\global\test.txt`
+	content := []byte("test")
+	// Blocks are ordered by name, so the attributes file is block 0 and the test file block 1
+	attributes := make([]byte, 16)
+	binary.LittleEndian.PutUint32(attributes[0:], 100)
+	binary.LittleEndian.PutUint32(attributes[4:], attributesCRC32)
+	binary.LittleEndian.PutUint32(attributes[12:], crc32.ChecksumIEEE(content))
+	corrupt := []byte("tesT")
+	for _, test := range []struct {
+		files    map[string][]byte
+		expected func(error) bool
+	}{
+		{map[string][]byte{name: content, attributesFileName: attributes}, func(err error) bool { return err == nil }},
+		{map[string][]byte{name: corrupt, attributesFileName: attributes}, func(err error) bool {
+			return err != nil && err != ErrNoFileCRC
+		}},
+		{map[string][]byte{name: content}, func(err error) bool { return err == ErrNoFileCRC }},
+	} {
+		fileName := writeTestMPQ(t, test.files)
+		defer os.RemoveAll(filepath.Dir(fileName))
+		mpq, err := LoadUncached(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mpq.Close()
+		if err := mpq.VerifyFileCRC(name); !test.expected(err) {
+			t.Fatalf("Unexpected result %v for %s", err, string(test.files[name]))
+		}
+	}
+}
+
+func TestOrphanBlocks(t *testing.T) {
+	mpq := MPQ{
+		HashTableEntries: []HashTableEntry{{BlockIndex: 0}, {BlockIndex: hashEntryEmpty}, {BlockIndex: hashEntryDeleted}},
+		BlockTableEntries: []BlockTableEntry{
+			{Flags: FileExists},
+			{Flags: FileExists},
+			{},
+			{Flags: FileExists | FileCompress},
+		},
+	}
+	orphans := mpq.OrphanBlocks()
+	if len(orphans) != 2 || orphans[0] != 1 || orphans[1] != 3 {
+		t.Fatalf("Expected blocks 1 and 3 to be orphaned, got %v", orphans)
+	}
+}
+
+func TestSetLanguageCode(t *testing.T) {
+	fileName := writeTestMPQ(t, map[string][]byte{
+		`data\local\lng\eng\string.tbl`: []byte("eng"),
+		`data\local\lng\deu\string.tbl`: []byte("deu"),
+	})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	mpq.SetLanguageCode("deu")
+	data, err := mpq.ReadFile(`data\local\lng\{LANG}\string.tbl`)
+	if err != nil || string(data) != "deu" {
+		t.Fatalf("Expected the archive language code to be used, got %q (%v)", data, err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	files := map[string][]byte{
+		`data\global\a.txt`: []byte("a"),
+		`data\global\b.txt`: []byte("b"),
+		listfileName:        []byte("data\\global\\a.txt\r\ndata\\global\\b.txt\r\ndata\\global\\missing.txt\r\n"),
+	}
+	fileName := writeTestMPQ(t, files)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	src, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	destPath := filepath.Join(filepath.Dir(fileName), "repaired.mpq")
+	report, err := Repair(src, destPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Kept) != 2 || len(report.Dropped) != 1 || report.Dropped[0].FileName != `data\global\missing.txt` {
+		t.Fatalf("Expected the missing file to be dropped, got %+v", report)
+	}
+	repaired, err := LoadUncached(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repaired.Close()
+	for _, name := range []string{`data\global\a.txt`, `data\global\b.txt`} {
+		data, err := repaired.ReadFile(name)
+		if err != nil || !bytes.Equal(data, files[name]) {
+			t.Fatalf("Expected %s to be kept, got %q (%v)", name, data, err)
+		}
+	}
+	fileList, err := repaired.GetFileList()
+	if err != nil || len(fileList) != 2 {
+		t.Fatalf("Expected the repaired archive to list the kept files, got %v (%v)", fileList, err)
+	}
+}
+
+func TestFileExistsNameIndex(t *testing.T) {
+	fileName := writeTestMPQ(t, map[string][]byte{
+		`data\global\a.txt`: []byte("a"),
+		`data\global\b.txt`: []byte("b"),
+		listfileName:        []byte("data\\global\\a.txt\r\n"),
+	})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if err := mpq.ResolveNames(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := mpq.nameIndex[`data\global\a.txt`]; !ok {
+		t.Fatal("Expected the listfile name to be indexed")
+	}
+	if !mpq.FileExists(`data\global\a.txt`) || !mpq.FileExists(`data\global\b.txt`) {
+		t.Fatal("Expected indexed and unlisted files to exist")
+	}
+	if !mpq.FileExists("Data/Global/A.txt") || !mpq.FileExists("DATA/global/b.TXT") {
+		t.Fatal("Expected names with forward slashes and mixed case to be found like ReadFile finds them")
+	}
+	if mpq.FileExists(`data\global\c.txt`) {
+		t.Fatal("Expected a missing file not to exist")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fileName := writeTestMPQ(t, map[string][]byte{`data\global\test.txt`: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadWithOptions(fileName, LoadOptions{NoCache: true, Verify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+
+	mpq.BlockTableEntries[0].CompressedFileSize = 1 << 20
+	if err := mpq.Verify(); err == nil {
+		t.Fatal("Expected an error for a block past the end of the file")
+	}
+	mpq.BlockTableEntries[0].CompressedFileSize = 4
+	mpq.HashTableEntries[0].BlockIndex = 5
+	if err := mpq.Verify(); err == nil {
+		t.Fatal("Expected an error for a hash entry referencing a missing block")
+	}
+	mpq.HashTableEntries = mpq.HashTableEntries[1:]
+	if err := mpq.Verify(); err == nil {
+		t.Fatal("Expected an error for a hash table size that does not match the header")
+	}
+}
+
+func TestTruncatedHashTable(t *testing.T) {
+	data := buildTestMPQWithOptions(map[string][]byte{`data\global\test.txt`: []byte("test")}, testArchiveOptions{})
+	// Point the hash table past the end of the file
+	binary.LittleEndian.PutUint32(data[16:], uint32(len(data)))
+	fileName := writeTestArchive(t, data)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	if _, err := LoadVerified(fileName); err == nil || !strings.Contains(err.Error(), "hash table") {
+		t.Fatalf("Expected a hash table error, got %v", err)
+	}
+	summaries, err := ScanDir(filepath.Dir(fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].Err == nil || summaries[0].FileCount != 0 {
+		t.Fatalf("Expected the archive to be summarized with an error, got %+v", summaries)
+	}
+}
+
+func TestLoadNameIndex(t *testing.T) {
+	fileName := writeTestMPQ(t, map[string][]byte{
+		`data\global\a.txt`: []byte("a"),
+		`data\global\b.txt`: []byte("b"),
+	})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if _, err := mpq.GetFileList(); err == nil {
+		t.Fatal("Expected an error listing an archive without a listfile")
+	}
+	if err := mpq.LoadNameIndex(strings.NewReader("2\tdata\\global\\c.txt\n")); err == nil {
+		t.Fatal("Expected an error for a block index out of range")
+	}
+	if err := mpq.LoadNameIndex(strings.NewReader("0\tdata\\global\\a.txt\r\n\n1\tdata\\global\\b.txt\n")); err != nil {
+		t.Fatal(err)
+	}
+	fileList, err := mpq.GetFileList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fileList) != 2 || fileList[0] != `data\global\a.txt` || fileList[1] != `data\global\b.txt` {
+		t.Fatalf("Expected the indexed names to be listed, got %v", fileList)
+	}
+}
+
+func TestLoadScan(t *testing.T) {
+	stub := bytes.Repeat([]byte{0xCC}, 3*512)
+	archive := append(stub, buildTestMPQ(map[string][]byte{`data\global\test.txt`: []byte("test")})...)
+	fileName := writeTestArchive(t, archive)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	if _, err := LoadUncached(fileName); err == nil {
+		t.Fatal("Expected an error loading an appended archive without scanning")
+	}
+	mpq, err := LoadWithOptions(fileName, LoadOptions{NoCache: true, Scan: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	content, err := mpq.ReadFile(`data\global\test.txt`)
+	if err != nil || string(content) != "test" {
+		t.Fatalf("Expected to read the file of the appended archive, got %q (%v)", content, err)
+	}
+
+	fileName = writeTestArchive(t, stub)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	if _, err := LoadWithOptions(fileName, LoadOptions{NoCache: true, Scan: true}); err == nil {
+		t.Fatal("Expected an error for a file without an archive")
+	}
+}
+
+func TestReadFileAt(t *testing.T) {
+	const name = `data\global\video.bik`
+	content := make([]byte, 1500)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	for _, sectors := range []bool{false, true} {
+		data := buildTestMPQWithOptions(map[string][]byte{name: content}, testArchiveOptions{sectors: sectors})
+		fileName := writeTestArchive(t, data)
+		defer os.RemoveAll(filepath.Dir(fileName))
+		mpq, err := LoadUncached(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mpq.Close()
+		buffer := make([]byte, 100)
+		n, err := mpq.ReadFileAt(name, 480, buffer)
+		if err != nil || n != 100 || !bytes.Equal(buffer, content[480:580]) {
+			t.Fatalf("Expected to read the range across a sector boundary, got %d bytes (%v)", n, err)
+		}
+		n, err = mpq.ReadFileAt(name, 1450, buffer)
+		if err != io.EOF || n != 50 || !bytes.Equal(buffer[:n], content[1450:]) {
+			t.Fatalf("Expected a short read with io.EOF at the end of the file, got %d bytes (%v)", n, err)
+		}
+		if _, err := mpq.ReadFileAt(name, 1500, buffer); err != io.EOF {
+			t.Fatalf("Expected io.EOF past the end of the file, got %v", err)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	fileName := writeTestMPQ(t, map[string][]byte{
+		`data\global\chars\am\cof\amnuhth.cof`: []byte("a"),
+		`data\global\chars\ba\cof\banuhth.cof`: []byte("b"),
+		`data\global\chars\ba\hd\bahdlit.dcc`:  []byte("c"),
+		listfileName: []byte("Data\\Global\\Chars\\AM\\COF\\amnuhth.cof\r\n" +
+			"data\\global\\chars\\ba\\cof\\banuhth.cof\r\ndata\\global\\chars\\ba\\hd\\bahdlit.dcc\r\n"),
+	})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	for _, pattern := range []string{`data\global\chars\*\cof\*.cof`, "DATA/global/chars/*/cof/*.cof"} {
+		matches, err := mpq.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 2 || matches[0] != `Data\Global\Chars\AM\COF\amnuhth.cof` {
+			t.Fatalf("Expected the two cof files to match %q, got %v", pattern, matches)
+		}
+	}
+	if _, err := mpq.Glob("data/["); err == nil {
+		t.Fatal("Expected an error for a malformed pattern")
+	}
+}
+
+func TestLoadCaseVariantsShareArchive(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("archives are only opened ignoring case on Linux")
+	}
+	fileName := writeTestMPQ(t, map[string][]byte{`data\global\test.txt`: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	variant, err := Load(filepath.Join(filepath.Dir(fileName), "TEST.MPQ"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variant != mpq {
+		t.Fatal("Expected names that only differ in case to share one archive")
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	const name = `data\global\test.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("test"), `data\global\other.txt`: []byte("other")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if _, err := mpq.ReadFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mpq.ReadFile(`data\global\other.txt`); err != nil {
+		t.Fatal(err)
+	}
+	mpq.Invalidate(name)
+	if mpq.fileCache.get(name) != nil {
+		t.Fatal("Expected the file to be dropped from the file cache")
+	}
+	if mpq.fileCache.len() != 1 {
+		t.Fatal("Expected the other file to stay cached")
+	}
+	mpq.InvalidateAll()
+	if mpq.fileCache.len() != 0 {
+		t.Fatal("Expected all files to be dropped from the file cache")
+	}
+}
+
+// testBlockCacheKey returns the block cache key of a file in the archive
+func testBlockCacheKey(t *testing.T, mpq *MPQ, name string) blockCacheKey {
+	t.Helper()
+	entry, err := mpq.getFileBlockData(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := mpq.readStored(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newBlockCacheKey(entry, stored)
+}
+
+func TestBlockCache(t *testing.T) {
+	ClearBlockCache()
+	defer ClearBlockCache()
+	defer SetBlockCacheLimit(DefaultBlockCacheLimit)
+	shared := bytes.Repeat([]byte("shared"), 200)
+	files := map[string][]byte{
+		`data\global\a.txt`: bytes.Repeat([]byte("a"), 1000),
+		`data\global\b.txt`: bytes.Repeat([]byte("b"), 1000),
+		`data\global\c.txt`: bytes.Repeat([]byte("c"), 1000),
+		`data\global\s.txt`: shared,
+	}
+	fileName := writeTestArchive(t, buildTestMPQWithOptions(files, testArchiveOptions{sectors: true}))
+	defer os.RemoveAll(filepath.Dir(fileName))
+	otherName := writeTestArchive(t, buildTestMPQWithOptions(map[string][]byte{`data\local\copy.txt`: shared},
+		testArchiveOptions{sectors: true}))
+	defer os.RemoveAll(filepath.Dir(otherName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	other, err := LoadUncached(otherName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	// The same stored bytes under another name in another archive share the decoded file
+	first, err := mpq.ReadFile(`data\global\s.txt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := other.ReadFile(`data\local\copy.txt`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(second, shared) || &first[0] != &second[0] {
+		t.Fatal("Expected the identical file in the other archive to be served from the block cache")
+	}
+
+	// Files are evicted oldest first once the limit is reached
+	ClearBlockCache()
+	SetBlockCacheLimit(2500)
+	for _, name := range []string{`data\global\a.txt`, `data\global\b.txt`, `data\global\c.txt`} {
+		if _, err := mpq.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := getCachedBlock(testBlockCacheKey(t, mpq, `data\global\a.txt`)); ok {
+		t.Fatal("Expected the oldest file to be evicted")
+	}
+	for _, name := range []string{`data\global\b.txt`, `data\global\c.txt`} {
+		if _, ok := getCachedBlock(testBlockCacheKey(t, mpq, name)); !ok {
+			t.Fatalf("Expected %s to stay cached", name)
+		}
+	}
+	SetBlockCacheLimit(1500)
+	if _, ok := getCachedBlock(testBlockCacheKey(t, mpq, `data\global\b.txt`)); ok || blockCache.size != 1000 {
+		t.Fatalf("Expected lowering the limit to evict down to it, got %d bytes", blockCache.size)
+	}
+
+	// Files larger than the limit are not cached
+	SetBlockCacheLimit(500)
+	mpq.Invalidate(`data\global\a.txt`)
+	if _, err := mpq.ReadFile(`data\global\a.txt`); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := getCachedBlock(testBlockCacheKey(t, mpq, `data\global\a.txt`)); ok {
+		t.Fatal("Expected a file larger than the limit not to be cached")
+	}
+
+	SetBlockCacheLimit(DefaultBlockCacheLimit)
+	mpq.Invalidate(`data\global\s.txt`)
+	if _, err := mpq.ReadFile(`data\global\s.txt`); err != nil {
+		t.Fatal(err)
+	}
+	if len(blockCache.entries) != 1 {
+		t.Fatalf("Expected the file to be cached, got %d files", len(blockCache.entries))
+	}
+	ClearBlockCache()
+	if len(blockCache.entries) != 0 || len(blockCache.order) != 0 || blockCache.size != 0 {
+		t.Fatal("Expected ClearBlockCache to drop every file")
+	}
+}
+
+func TestReadRawFile(t *testing.T) {
+	const name = `data\global\test.txt`
+	content := []byte("test")
+	fileName := writeTestArchive(t, buildTestMPQWithOptions(map[string][]byte{name: content},
+		testArchiveOptions{sectors: true}))
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	raw, err := mpq.ReadRawFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := encodeTestSectors(content, mpq.SectorSize()); !bytes.Equal(raw, expected) {
+		t.Fatalf("Expected the stored bytes including the offset table, got %v", raw)
+	}
+	if _, err := mpq.ReadRawFile(`data\global\missing.txt`); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+}
+
+func TestLoadMemoryMap(t *testing.T) {
+	files := map[string][]byte{
+		`data\global\raw.txt`:     []byte("raw"),
+		`data\global\sectors.txt`: bytes.Repeat([]byte("sectors"), 2000),
+	}
+	for _, sectors := range []bool{false, true} {
+		fileName := writeTestArchive(t, buildTestMPQWithOptions(files, testArchiveOptions{sectors: sectors}))
+		mpq, err := LoadWithOptions(fileName, LoadOptions{NoCache: true, MemoryMap: true})
+		if err != nil {
+			os.RemoveAll(filepath.Dir(fileName))
+			t.Fatal(err)
+		}
+		if runtime.GOOS == "linux" && mpq.mapping == nil {
+			t.Fatal("Expected the archive to be memory-mapped")
+		}
+		for name, content := range files {
+			data, err := mpq.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, content) {
+				t.Fatalf("Expected %s to read the same from the mapping, got %d bytes", name, len(data))
+			}
+		}
+		mpq.Close()
+		os.RemoveAll(filepath.Dir(fileName))
+	}
+}
+
+func TestCloseWhileReading(t *testing.T) {
+	files := map[string][]byte{
+		`data\global\raw.txt`:     bytes.Repeat([]byte("raw"), 5000),
+		`data\global\sectors.txt`: bytes.Repeat([]byte("sectors"), 5000),
+	}
+	for _, sectors := range []bool{false, true} {
+		fileName := writeTestArchive(t, buildTestMPQWithOptions(files, testArchiveOptions{sectors: sectors}))
+		defer os.RemoveAll(filepath.Dir(fileName))
+		mpq, err := LoadWithOptions(fileName, LoadOptions{NoCache: true, MemoryMap: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		closed := make(chan struct{})
+		waitGroup := sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				for {
+					for name, content := range files {
+						buffer := make([]byte, len(content))
+						if n, err := mpq.ReadFileInto(name, buffer); err == nil && !bytes.Equal(buffer[:n], content) {
+							t.Errorf("Expected %s to read the same or fail, got %d bytes", name, n)
+						}
+						if n, err := mpq.ReadFileAt(name, 100, buffer[:100]); err == nil && !bytes.Equal(buffer[:n], content[100:200]) {
+							t.Errorf("Expected the range of %s to read the same or fail", name)
+						}
+					}
+					select {
+					case <-closed:
+						return
+					default:
+					}
+				}
+			}()
+		}
+		mpq.Close()
+		close(closed)
+		waitGroup.Wait()
+		for name := range files {
+			if _, err := mpq.ReadRawFile(name); err == nil {
+				t.Fatalf("Expected reading %s from the closed archive to fail", name)
+			}
+		}
+	}
+}
+
+func TestRawTables(t *testing.T) {
+	const name = `data\global\test.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	hashTable := mpq.RawHashTable()
+	if len(hashTable) != len(mpq.HashTableEntries)*16 {
+		t.Fatalf("Expected %d hash table bytes, got %d", len(mpq.HashTableEntries)*16, len(hashTable))
+	}
+	for i, entry := range mpq.HashTableEntries {
+		if binary.LittleEndian.Uint32(hashTable[i*16:]) != entry.NamePartA ||
+			binary.LittleEndian.Uint32(hashTable[i*16+12:]) != entry.BlockIndex {
+			t.Fatalf("Expected hash table entry %d to match the parsed one", i)
+		}
+	}
+	blockTable := mpq.RawBlockTable()
+	if len(blockTable) != len(mpq.BlockTableEntries)*16 {
+		t.Fatalf("Expected %d block table bytes, got %d", len(mpq.BlockTableEntries)*16, len(blockTable))
+	}
+	for i, entry := range mpq.BlockTableEntries {
+		if binary.LittleEndian.Uint32(blockTable[i*16+8:]) != entry.UncompressedFileSize ||
+			FileFlag(binary.LittleEndian.Uint32(blockTable[i*16+12:])) != entry.Flags {
+			t.Fatalf("Expected block table entry %d to match the parsed one", i)
+		}
+	}
+}
+
+func TestBuildListfile(t *testing.T) {
+	listfile := BuildListfile([]string{"data/global/a.txt", "", `DATA\GLOBAL\A.TXT`, `data\global\b.txt`})
+	if expected := "data\\global\\a.txt\r\ndata\\global\\b.txt\r\n"; string(listfile) != expected {
+		t.Fatalf("Expected %q, got %q", expected, listfile)
+	}
+}
+
+func TestRepack(t *testing.T) {
+	files := map[string][]byte{
+		`data\global\a.txt`: []byte("a"),
+		`data\global\b.txt`: []byte("b"),
+	}
+	fileName := writeTestMPQ(t, files)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	src, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	destPath := filepath.Join(filepath.Dir(fileName), "repacked.mpq")
+	if err := Repack(src, destPath, []string{`data\global\missing.txt`}); err == nil {
+		t.Fatal("Expected an error for a file the archive does not have")
+	}
+	if err := Repack(src, destPath, []string{"data/global/a.txt", `data\global\b.txt`}); err != nil {
+		t.Fatal(err)
+	}
+	repacked, err := LoadUncached(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repacked.Close()
+	listfile, err := repacked.ReadFile(listfileName)
+	if expected := "data\\global\\a.txt\r\ndata\\global\\b.txt\r\n"; err != nil || string(listfile) != expected {
+		t.Fatalf("Expected the listfile %q, got %q (%v)", expected, listfile, err)
+	}
+	for name, content := range files {
+		if data, err := repacked.ReadFile(name); err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("Expected %s to be copied, got %q (%v)", name, data, err)
+		}
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	files := map[string][]byte{
+		`data\global\a.txt`: bytes.Repeat([]byte("a"), 10000),
+		`data\global\b.txt`: bytes.Repeat([]byte("b"), 100),
+	}
+	var fileNames []string
+	for _, sectors := range []bool{false, true} {
+		fileName := writeTestArchive(t, buildTestMPQWithOptions(files, testArchiveOptions{sectors: sectors}))
+		defer os.RemoveAll(filepath.Dir(fileName))
+		fileNames = append(fileNames, fileName)
+	}
+	readAll := func(mpq *MPQ) {
+		for name, content := range files {
+			data, err := mpq.ReadFile(name)
+			if err != nil || !bytes.Equal(data, content) {
+				t.Errorf("Expected %s to read the same from every goroutine, got %d bytes (%v)", name, len(data), err)
+			}
+		}
+	}
+	waitGroup := sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		waitGroup.Add(1)
+		go func(worker int) {
+			defer waitGroup.Done()
+			for iteration := 0; iteration < 20; iteration++ {
+				fileName := fileNames[(worker+iteration)%len(fileNames)]
+				shared, err := Load(fileName)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				readAll(shared)
+				if iteration%5 == 0 {
+					shared.Invalidate(`data\global\a.txt`)
+				}
+				owned, err := LoadWithOptions(fileName, LoadOptions{NoCache: true, MemoryMap: worker%2 == 0})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				readAll(owned)
+				owned.Close()
+			}
+		}(i)
+	}
+	waitGroup.Wait()
+	for _, fileName := range fileNames {
+		shared, err := Load(fileName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shared.Close()
+	}
+}
+
+func TestFileLocales(t *testing.T) {
+	const name = `data\global\test.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	if locales := mpq.FileLocales(name); len(locales) != 1 || locales[0] != 0 {
+		t.Fatalf("Expected the neutral locale, got %v", locales)
+	}
+	// Store the file under a second locale after a deleted entry, which the probe chain continues past
+	_, _, home := FileNameHashes(name)
+	idx := home % uint32(len(mpq.HashTableEntries))
+	entry := mpq.HashTableEntries[idx]
+	entry.Locale = 0x407
+	mpq.HashTableEntries[(idx+1)%uint32(len(mpq.HashTableEntries))] = HashTableEntry{BlockIndex: hashEntryDeleted}
+	mpq.HashTableEntries[(idx+2)%uint32(len(mpq.HashTableEntries))] = entry
+	for _, variant := range []string{name, "Data/Global/TEST.txt"} {
+		if locales := mpq.FileLocales(variant); len(locales) != 2 || locales[0] != 0 || locales[1] != 0x407 {
+			t.Fatalf("Expected the neutral and German locales for %s, got %v", variant, locales)
+		}
+	}
+	if locales := mpq.FileLocales(`data\global\missing.txt`); len(locales) != 0 {
+		t.Fatalf("Expected no locales for a missing file, got %v", locales)
+	}
+	empty := MPQ{}
+	if locales := empty.FileLocales(name); len(locales) != 0 {
+		t.Fatalf("Expected no locales for an archive without a hash table, got %v", locales)
+	}
+}
+
+func TestLoadUncached(t *testing.T) {
+	const name = `data\global\test.txt`
+	fileName := writeTestMPQ(t, map[string][]byte{name: []byte("test")})
+	defer os.RemoveAll(filepath.Dir(fileName))
+	uncached, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mpqMutex.Lock()
+	_, isCached := mpqCache[archiveCacheKey(fileName)]
+	mpqMutex.Unlock()
+	if isCached {
+		t.Fatal("Expected an uncached load not to add the archive to the cache")
+	}
+	cached, err := Load(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cached.Close()
+	other, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if uncached == cached || other == uncached {
+		t.Fatal("Expected every uncached load to open its own archive")
+	}
+	// Closing an uncached archive must not remove the cached one
+	uncached.Close()
+	if reloaded, err := Load(fileName); err != nil || reloaded != cached {
+		t.Fatalf("Expected the cached archive to stay cached, got %p (%v)", reloaded, err)
+	}
+	if data, err := cached.ReadFile(name); err != nil || string(data) != "test" {
+		t.Fatalf("Expected to read the cached archive, got %q (%v)", data, err)
+	}
+
+	if _, err := LoadUncached(filepath.Join(filepath.Dir(fileName), "missing.mpq")); err == nil {
+		t.Fatal("Expected an error for a missing archive")
+	}
+	invalid := writeTestArchive(t, make([]byte, 64))
+	defer os.RemoveAll(filepath.Dir(invalid))
+	if _, err := LoadUncached(invalid); err == nil {
+		t.Fatal("Expected an error for a file without an MPQ header")
+	}
+}
+
+// encodeTestSectorChecksums stores the data in uncompressed sectors followed by a sector checksum table, with the
+// extra offset that marks the end of the table
+func encodeTestSectorChecksums(data []byte, sectorSize int, checksums []uint32) []byte {
+	sectorCount := (len(data) + sectorSize - 1) / sectorSize
+	tableSize := (sectorCount + 2) * 4
+	offsets := make([]byte, tableSize)
+	for i := 0; i <= sectorCount; i++ {
+		end := i * sectorSize
+		if end > len(data) {
+			end = len(data)
+		}
+		binary.LittleEndian.PutUint32(offsets[i*4:], uint32(tableSize+end))
+	}
+	binary.LittleEndian.PutUint32(offsets[(sectorCount+1)*4:], uint32(tableSize+len(data)+(len(checksums)*4)))
+	result := append(offsets, data...)
+	for _, checksum := range checksums {
+		result = append(result, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(result[len(result)-4:], checksum)
+	}
+	return result
+}
+
+func TestFileSectorChecksums(t *testing.T) {
+	const sectorSize = 0x200 << 3
+	content := bytes.Repeat([]byte("sector"), 1000)
+	checksums := []uint32{0x11111111, 0x22222222}
+	files := map[string][]byte{
+		`data\global\crc.txt`:   encodeTestSectorChecksums(content, sectorSize, checksums),
+		`data\global\empty.txt`: encodeTestSectorChecksums(content, sectorSize, nil),
+		`data\global\plain.txt`: []byte("plain"),
+	}
+	fileName := writeTestMPQ(t, files)
+	defer os.RemoveAll(filepath.Dir(fileName))
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mpq.Close()
+	// The test archives store files as a single piece, so flag the sectored files as compressed with checksums
+	for _, name := range []string{`data\global\crc.txt`, `data\global\empty.txt`} {
+		hashEntry, err := mpq.getFileHashEntry(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := &mpq.BlockTableEntries[hashEntry.BlockIndex]
+		block.Flags |= FileCompress | FileSectorCrc
+		block.UncompressedFileSize = uint32(len(content))
+	}
+
+	result, err := mpq.FileSectorChecksums("Data/Global/CRC.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != len(checksums) || result[0] != checksums[0] || result[1] != checksums[1] {
+		t.Fatalf("Expected the checksums %x, got %x", checksums, result)
+	}
+	if data, err := mpq.ReadFile(`data\global\crc.txt`); err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("Expected the sectors to be read past the checksum offset, got %d bytes (%v)", len(data), err)
+	}
+
+	for _, test := range []struct {
+		name     string
+		expected string
+	}{
+		{`data\global\empty.txt`, "empty"},
+		{`data\global\plain.txt`, "no sector checksums"},
+		{`data\global\missing.txt`, "not found"},
+	} {
+		if _, err := mpq.FileSectorChecksums(test.name); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("Expected an error containing %q for %s, got %v", test.expected, test.name, err)
+		}
+	}
+}
+
+func TestScanDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "d2mpq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	listed := buildTestMPQ(map[string][]byte{
+		`data\global\a.txt`: []byte("a"),
+		listfileName:        []byte("data\\global\\a.txt\r\n"),
+	})
+	unlisted := buildTestMPQ(map[string][]byte{`data\global\a.txt`: []byte("a"), `data\global\b.txt`: []byte("b")})
+	// An archive whose hash table is past the end of the file
+	truncated := buildTestMPQ(map[string][]byte{`data\global\a.txt`: []byte("a")})
+	binary.LittleEndian.PutUint32(truncated[16:], uint32(len(truncated)))
+	for name, data := range map[string][]byte{
+		"b.mpq":     listed,
+		"A.MPQ":     unlisted,
+		"c.mpq":     []byte("not an archive"),
+		"d.mpq":     truncated,
+		"notes.txt": []byte("notes"),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub.mpq"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	summaries, err := ScanDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 4 {
+		t.Fatalf("Expected 4 archives, got %+v", summaries)
+	}
+	expected := []ArchiveSummary{
+		{Name: "A.MPQ", Size: int64(len(unlisted)), FileCount: 2},
+		{Name: "b.mpq", Size: int64(len(listed)), FileCount: 1, HasListfile: true},
+	}
+	for i, summary := range summaries[:2] {
+		expected[i].Path = filepath.Join(dir, expected[i].Name)
+		if summary != expected[i] {
+			t.Fatalf("Expected the summary %+v, got %+v", expected[i], summary)
+		}
+	}
+	for i, name := range []string{"c.mpq", "d.mpq"} {
+		if summary := summaries[i+2]; summary.Name != name || summary.Err == nil || summary.FileCount != 0 {
+			t.Fatalf("Expected %s to be summarized with an error, got %+v", name, summary)
+		}
+	}
+	mpqMutex.Lock()
+	_, isCached := mpqCache[archiveCacheKey(filepath.Join(dir, "b.mpq"))]
+	mpqMutex.Unlock()
+	if isCached {
+		t.Fatal("Expected scanned archives not to be cached")
+	}
+
+	if _, err := ScanDir(filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("Expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,47 @@
+package d2mpq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LoadNameIndex reads an external name index and sets the FileName of the block table entries it names. The index has
+// one "block index<tab>file name" pair per line, and blank lines are skipped. This allows archives without a listfile
+// to be listed, since GetFileList falls back to the named blocks.
+func (v *MPQ) LoadNameIndex(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimRight(s.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		fields := strings.SplitN(text, "\t", 2)
+		if len(fields) != 2 || fields[1] == "" {
+			return fmt.Errorf("name index line %d is not an index and a name separated by a tab", line)
+		}
+		blockIndex, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("name index line %d has an invalid block index: %v", line, err)
+		}
+		if blockIndex >= uint64(len(v.BlockTableEntries)) {
+			return fmt.Errorf("name index line %d references block %d, but the block table has %d entries",
+				line, blockIndex, len(v.BlockTableEntries))
+		}
+		v.BlockTableEntries[blockIndex].FileName = fields[1]
+	}
+	return s.Err()
+}
+
+// namedFiles returns the names of the existing blocks that have a FileName
+func (v MPQ) namedFiles() []string {
+	var filePaths []string
+	for _, blockEntry := range v.BlockTableEntries {
+		if blockEntry.FileName != "" && blockEntry.HasFlag(FileExists) {
+			filePaths = append(filePaths, blockEntry.FileName)
+		}
+	}
+	return filePaths
+}
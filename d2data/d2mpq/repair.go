@@ -0,0 +1,69 @@
+package d2mpq
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RepairFailure is a file Repair could not salvage
+type RepairFailure struct {
+	FileName string
+	Err      error
+}
+
+// RepairReport lists the files Repair kept and the ones it dropped
+type RepairReport struct {
+	Kept    []string
+	Dropped []RepairFailure
+}
+
+// Repair rebuilds an archive from the files of its listfile that can still be read, and writes it to destPath. When
+// verify is set, files whose CRC32 does not match the one stored in the (attributes) file are dropped too. The
+// listfile and attributes of the source archive are not copied; the new archive gets a listfile of the kept files.
+func Repair(src *MPQ, destPath string, verify bool) (RepairReport, error) {
+	report := RepairReport{}
+	fileList, err := src.GetFileList()
+	if err != nil {
+		return report, fmt.Errorf("unable to read the listfile: %v", err)
+	}
+	writer := NewWriter()
+	for _, fileName := range fileList {
+		if fileName == "" || fileName == listfileName || fileName == attributesFileName {
+			continue
+		}
+		data, err := salvageFile(src, fileName, verify)
+		if err != nil {
+			report.Dropped = append(report.Dropped, RepairFailure{FileName: fileName, Err: err})
+			continue
+		}
+		writer.AddFile(fileName, data)
+		report.Kept = append(report.Kept, fileName)
+	}
+	return report, writer.WriteFile(destPath)
+}
+
+// salvageFile reads a file, turning the panics raised by corrupt data into errors
+func salvageFile(src *MPQ, fileName string, verify bool) (data []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unable to read the file: %v", r)
+		}
+	}()
+	blockData, err := src.getFileBlockData(src.normalizeName(fileName))
+	if err != nil {
+		return nil, err
+	}
+	if blockData.HasFlag(FilePatchFile) {
+		return nil, errors.New("patch files are not supported")
+	}
+	data, err = src.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if verify {
+		if err = src.VerifyFileCRC(fileName); err != nil && err != ErrNoFileCRC {
+			return nil, err
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,57 @@
+package d2mpq
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ArchiveSummary describes an archive found by ScanDir
+type ArchiveSummary struct {
+	Name        string // File name of the archive
+	Path        string // Full path of the archive
+	Size        int64  // Size of the archive file, in bytes
+	FileCount   int    // Number of files in the listfile, or in the block table when there is no listfile
+	HasListfile bool   // True if the archive has a listfile
+	Err         error  // Set if the archive could not be read, in which case the counts are zero
+}
+
+// ScanDir summarizes all MPQ archives in a directory. Each archive is opened only while it is read, and is not added
+// to the archive cache.
+func ScanDir(dir string) ([]ArchiveSummary, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var result []ArchiveSummary
+	for _, file := range files {
+		if file.IsDir() || !strings.EqualFold(filepath.Ext(file.Name()), ".mpq") {
+			continue
+		}
+		summary := ArchiveSummary{
+			Name: file.Name(),
+			Path: filepath.Join(dir, file.Name()),
+			Size: file.Size(),
+		}
+		summary.FileCount, summary.HasListfile, summary.Err = summarizeArchive(summary.Path)
+		result = append(result, summary)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func summarizeArchive(fileName string) (fileCount int, hasListfile bool, err error) {
+	mpq, err := LoadUncached(fileName)
+	if err != nil {
+		return 0, false, err
+	}
+	defer mpq.File.Close()
+	fileList, err := mpq.GetFileList()
+	if err != nil {
+		return len(mpq.BlockTableEntries), false, nil
+	}
+	return len(fileList), true, nil
+}
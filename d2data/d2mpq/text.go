@@ -0,0 +1,42 @@
+package d2mpq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// Byte order marks that identify the encoding of a text file
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// decodeText converts the content of a text file into a string, without a leading byte order mark or the trailing
+// null padding many of the game's text files carry. Files starting with a UTF-16 byte order mark are decoded to UTF-8,
+// anything else is used as is.
+func decodeText(data []byte) string {
+	var text string
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		text = string(data[len(utf8BOM):])
+	case bytes.HasPrefix(data, utf16LEBOM):
+		text = decodeUTF16(data[len(utf16LEBOM):], binary.LittleEndian)
+	case bytes.HasPrefix(data, utf16BEBOM):
+		text = decodeUTF16(data[len(utf16BEBOM):], binary.BigEndian)
+	default:
+		text = string(data)
+	}
+	return strings.TrimRight(text, "\x00")
+}
+
+// decodeUTF16 decodes UTF-16 text into a UTF-8 string. A trailing odd byte is ignored.
+func decodeUTF16(data []byte, byteOrder binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = byteOrder.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
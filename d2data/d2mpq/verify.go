@@ -0,0 +1,56 @@
+package d2mpq
+
+import "fmt"
+
+// Verify checks that the loaded tables are consistent with the header and the file. The table sizes must match the
+// entry counts in the header, the tables must lie within the file, hash entries must reference existing blocks and
+// the data of every existing file must lie within the file.
+func (v MPQ) Verify() error {
+	fileInfo, err := v.File.Stat()
+	if err != nil {
+		return err
+	}
+	fileSize := fileInfo.Size()
+	if len(v.HashTableEntries) != int(v.Data.HashTableEntries) {
+		return fmt.Errorf("hash table has %d entries, but the header declares %d",
+			len(v.HashTableEntries), v.Data.HashTableEntries)
+	}
+	if len(v.BlockTableEntries) != int(v.Data.BlockTableEntries) {
+		return fmt.Errorf("block table has %d entries, but the header declares %d",
+			len(v.BlockTableEntries), v.Data.BlockTableEntries)
+	}
+	hashTableOffset := v.filePosition(int64(v.ExtendedData.HashTableOffsetHigh)<<32 | int64(v.Data.HashTableOffset))
+	if hashTableOffset+int64(len(v.HashTableEntries))*16 > fileSize {
+		return fmt.Errorf("hash table at offset %d is past the end of the %d byte file", hashTableOffset, fileSize)
+	}
+	blockTableOffset := v.filePosition(int64(v.ExtendedData.BlockTableOffsetHigh)<<32 | int64(v.Data.BlockTableOffset))
+	if blockTableOffset+int64(len(v.BlockTableEntries))*16 > fileSize {
+		return fmt.Errorf("block table at offset %d is past the end of the %d byte file", blockTableOffset, fileSize)
+	}
+	if v.ExtendedData.HiBlockTableOffset != 0 {
+		hiBlockTableOffset := v.filePosition(int64(v.ExtendedData.HiBlockTableOffset))
+		if hiBlockTableOffset+int64(len(v.BlockTableEntries))*2 > fileSize {
+			return fmt.Errorf("hi-block table at offset %d is past the end of the %d byte file",
+				hiBlockTableOffset, fileSize)
+		}
+	}
+	for idx, hashEntry := range v.HashTableEntries {
+		if hashEntry.BlockIndex == hashEntryEmpty || hashEntry.BlockIndex == hashEntryDeleted {
+			continue
+		}
+		if hashEntry.BlockIndex >= uint32(len(v.BlockTableEntries)) {
+			return fmt.Errorf("hash entry %d references block %d, but the block table has %d entries",
+				idx, hashEntry.BlockIndex, len(v.BlockTableEntries))
+		}
+	}
+	for idx, blockEntry := range v.BlockTableEntries {
+		if !blockEntry.HasFlag(FileExists) {
+			continue
+		}
+		end := v.filePosition(blockEntry.position()) + int64(blockEntry.CompressedFileSize)
+		if end > fileSize {
+			return fmt.Errorf("block %d ends at offset %d, past the end of the %d byte file", idx, end, fileSize)
+		}
+	}
+	return nil
+}
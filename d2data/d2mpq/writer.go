@@ -0,0 +1,116 @@
+package d2mpq
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// listfileName is the name of the file that lists the names of the files in an archive
+const listfileName = "(listfile)"
+
+// Writer builds a new archive. Files are stored without compression or encryption, and a listfile naming all of them
+// is added.
+type Writer struct {
+	names []string
+	files map[string][]byte
+}
+
+// NewWriter creates an empty archive writer
+func NewWriter() *Writer {
+	return &Writer{files: make(map[string][]byte)}
+}
+
+// AddFile adds a file to the archive. Adding a file with the same name as an earlier one replaces it.
+func (v *Writer) AddFile(fileName string, data []byte) {
+	key := normalizeFileName(fileName)
+	if _, ok := v.files[key]; !ok {
+		v.names = append(v.names, fileName)
+	}
+	v.files[key] = data
+}
+
+// WriteFile writes the archive to a file
+func (v *Writer) WriteFile(fileName string) error {
+	buffer := new(bytes.Buffer)
+	if _, err := v.WriteTo(buffer); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, buffer.Bytes(), 0644)
+}
+
+// WriteTo writes the archive to w
+func (v *Writer) WriteTo(w io.Writer) (int64, error) {
+	names := append([]string{}, v.names...)
+	contents := make([][]byte, 0, len(names)+1)
+	for _, name := range names {
+		contents = append(contents, v.files[normalizeFileName(name)])
+	}
+	if _, ok := v.files[normalizeFileName(listfileName)]; !ok {
+		names = append(names, listfileName)
+		contents = append(contents, BuildListfile(v.names))
+	}
+
+	hashTableSize := uint32(16)
+	for hashTableSize < uint32(len(names))*2 {
+		hashTableSize *= 2
+	}
+	hashTable := make([]uint32, hashTableSize*4)
+	for i := range hashTable {
+		hashTable[i] = hashEntryEmpty
+	}
+	blockTable := make([]uint32, len(names)*4)
+	const headerSize = 32
+	content := new(bytes.Buffer)
+	for blockIndex, name := range names {
+		data := contents[blockIndex]
+		blockTable[blockIndex*4] = headerSize + uint32(content.Len())
+		blockTable[(blockIndex*4)+1] = uint32(len(data))
+		blockTable[(blockIndex*4)+2] = uint32(len(data))
+		blockTable[(blockIndex*4)+3] = uint32(FileExists)
+		content.Write(data)
+
+		nameA, nameB, tableIndex := FileNameHashes(name)
+		hashIndex := tableIndex & (hashTableSize - 1)
+		for hashTable[(hashIndex*4)+3] != hashEntryEmpty {
+			hashIndex = (hashIndex + 1) & (hashTableSize - 1)
+		}
+		hashTable[hashIndex*4] = nameA
+		hashTable[(hashIndex*4)+1] = nameB
+		hashTable[(hashIndex*4)+2] = 0
+		hashTable[(hashIndex*4)+3] = uint32(blockIndex)
+	}
+	hashTableOffset := headerSize + uint32(content.Len())
+	blockTableOffset := hashTableOffset + (hashTableSize * 16)
+	content.Write(encryptTable(hashTable, hashString("(hash table)", 3)))
+	content.Write(encryptTable(blockTable, hashString("(block table)", 3)))
+	if uint64(content.Len())+headerSize > 0xFFFFFFFF {
+		return 0, fmt.Errorf("archive of %d bytes is too large", uint64(content.Len())+headerSize)
+	}
+
+	archive := new(bytes.Buffer)
+	binary.Write(archive, binary.LittleEndian, Data{
+		Magic:             [4]byte{'M', 'P', 'Q', 0x1A},
+		HeaderSize:        headerSize,
+		ArchiveSize:       headerSize + uint32(content.Len()),
+		BlockSize:         3,
+		HashTableOffset:   hashTableOffset,
+		BlockTableOffset:  blockTableOffset,
+		HashTableEntries:  hashTableSize,
+		BlockTableEntries: uint32(len(names)),
+	})
+	archive.Write(content.Bytes())
+	return archive.WriteTo(w)
+}
+
+// encryptTable encodes a hash or block table and encrypts it with the seed
+func encryptTable(table []uint32, seed uint32) []byte {
+	data := make([]byte, len(table)*4)
+	for i, value := range table {
+		binary.LittleEndian.PutUint32(data[i*4:], value)
+	}
+	EncryptBytes(data, seed)
+	return data
+}
@@ -0,0 +1,42 @@
+package d2sprite
+
+// directionOrders maps the logical directions of sprites to the order their directions are stored in. Logical
+// direction 0 faces south and the following ones turn clockwise. Files store the four diagonals first, then the four
+// straight directions, then the directions in between them.
+var directionOrders = map[int][]int{
+	1:  {0},
+	4:  {0, 1, 2, 3},
+	8:  {4, 0, 5, 1, 6, 2, 7, 3},
+	16: {4, 8, 0, 9, 5, 10, 1, 11, 6, 12, 2, 13, 7, 14, 3, 15},
+	32: {
+		4, 16, 8, 17, 0, 18, 9, 19, 5, 20, 10, 21, 1, 22, 11, 23,
+		6, 24, 12, 25, 2, 26, 13, 27, 7, 28, 14, 29, 3, 30, 15, 31,
+	},
+}
+
+// DirectionOrder returns the stored direction index of every logical direction of a sprite with the given number of
+// directions. Logical direction 0 faces south and the following ones turn clockwise. Sprites with 4 directions only
+// hold the diagonals, starting with south west. Direction counts the game does not use are returned in stored order.
+func DirectionOrder(count int) []int {
+	order, ok := directionOrders[count]
+	if !ok {
+		order = make([]int, count)
+		for i := range order {
+			order[i] = i
+		}
+		return order
+	}
+	result := make([]int, len(order))
+	copy(result, order)
+	return result
+}
+
+// storedDirection converts a logical direction into the stored direction index, leaving directions out of range as
+// they are so the sprite reports them
+func storedDirection(direction, count int) int {
+	order, ok := directionOrders[count]
+	if !ok || direction < 0 || direction >= len(order) {
+		return direction
+	}
+	return order[direction]
+}
@@ -0,0 +1,64 @@
+package d2sprite
+
+import (
+	"fmt"
+	"image"
+	"path"
+	"strings"
+
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2dc6"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2dcc"
+)
+
+// Sprite is an animated sprite with its palette bound, regardless of the format it was loaded from
+type Sprite interface {
+	// DirectionCount returns the number of directions of the sprite
+	DirectionCount() int
+	// FrameCount returns the number of frames in each direction
+	FrameCount() int
+	// Frame renders a frame of a logical direction, which DirectionOrder maps to the direction stored in the file
+	Frame(direction, frame int) (*image.RGBA, error)
+}
+
+// frameSource is implemented by the sprite formats the package can load
+type frameSource interface {
+	DirectionCount() int
+	FrameCount() int
+	FrameImage(direction, frame int, palette d2datadict.PaletteRec) (*image.RGBA, image.Point, error)
+}
+
+// paletteSprite binds a palette to a sprite file
+type paletteSprite struct {
+	frameSource
+	palette d2datadict.PaletteRec
+}
+
+func (v paletteSprite) Frame(direction, frame int) (*image.RGBA, error) {
+	img, _, err := v.FrameImage(storedDirection(direction, v.DirectionCount()), frame, v.palette)
+	return img, err
+}
+
+// LoadSprite parses a DC6 or DCC file, picking the format from the extension of the name, and binds the palette to it
+func LoadSprite(name string, data []byte, palette d2datadict.PaletteRec) (Sprite, error) {
+	var (
+		source frameSource
+		err    error
+	)
+	switch extension := strings.ToLower(path.Ext(strings.ReplaceAll(name, `\`, "/"))); extension {
+	case ".dc6":
+		var dc6 d2dc6.DC6File
+		dc6, err = d2dc6.LoadDC6Raw(data)
+		source = &dc6
+	case ".dcc":
+		var dcc d2dcc.DCC
+		dcc, err = d2dcc.LoadDCCRaw(data)
+		source = dcc
+	default:
+		return nil, fmt.Errorf("%s: unsupported sprite format %q", name, extension)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return paletteSprite{frameSource: source, palette: palette}, nil
+}
@@ -0,0 +1,136 @@
+package d2sprite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/OpenDiablo2/D2Shared/d2common"
+	"github.com/OpenDiablo2/D2Shared/d2data/d2datadict"
+)
+
+// encodeTestDC6 builds a DC6 file with one 1x1 frame in each direction, where the pixel of stored direction i is
+// palette index i + 1
+func encodeTestDC6(directions int) []byte {
+	sw := d2common.CreateStreamWriter()
+	for _, value := range []uint32{6, 1, 0, 0xEEEEEEEE, uint32(directions), 1} {
+		sw.PushUint32(value)
+	}
+	const frameSize = 32 + 3 + 3
+	for i := 0; i < directions; i++ {
+		sw.PushUint32(uint32(24 + (directions * 4) + (i * frameSize)))
+	}
+	for i := 0; i < directions; i++ {
+		for _, value := range []uint32{0, 1, 1, 0, 0, 0, 0, 3} {
+			sw.PushUint32(value)
+		}
+		for _, b := range []byte{1, byte(i + 1), 0x80, 0xEE, 0xEE, 0xEE} {
+			sw.PushByte(b)
+		}
+	}
+	return sw.GetBytes()
+}
+
+// testDCC is a DCC file with one direction of one 4x4 frame filled with palette index 10
+var testDCC = []byte{
+	0x74, 0x06, 0x01, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x13,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x40, 0x55, 0x15, 0x00, 0x01, 0x01, 0xC0, 0x00, 0x00,
+	0x00, 0x08, 0x20, 0x80, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x08, 0x00, 0x00, 0x00,
+}
+
+// testPalette maps every palette index to a red value of the same number
+func testPalette() d2datadict.PaletteRec {
+	palette := d2datadict.PaletteRec{}
+	for i := range palette.Colors {
+		palette.Colors[i] = d2datadict.PaletteRGB{R: uint8(i)}
+	}
+	return palette
+}
+
+func TestLoadSpriteDC6(t *testing.T) {
+	for _, count := range []int{8, 16, 32, 5} {
+		sprite, err := LoadSprite(`data\global\ui\TEST.DC6`, encodeTestDC6(count), testPalette())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sprite.DirectionCount() != count || sprite.FrameCount() != 1 {
+			t.Fatalf("Expected %d directions of one frame, got %d of %d", count, sprite.DirectionCount(),
+				sprite.FrameCount())
+		}
+		order := DirectionOrder(count)
+		for direction := 0; direction < count; direction++ {
+			img, err := sprite.Frame(direction, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if red := int(img.Pix[0]); red != order[direction]+1 {
+				t.Fatalf("Expected logical direction %d of %d to draw stored direction %d, got %d", direction, count,
+					order[direction], red-1)
+			}
+		}
+		if _, err := sprite.Frame(count, 0); err == nil {
+			t.Fatalf("Expected an error for direction %d of %d", count, count)
+		}
+	}
+}
+
+func TestLoadSpriteDCC(t *testing.T) {
+	sprite, err := LoadSprite("test.dcc", testDCC, testPalette())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := sprite.Frame(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 4 || img.Pix[0] != 10 || img.Pix[3] != 0xFF {
+		t.Fatalf("Expected a 4x4 frame of palette index 10, got %v", img.Bounds())
+	}
+	if _, err := LoadSprite("test.dcc", testDCC[:len(testDCC)-1], testPalette()); err == nil ||
+		!strings.HasPrefix(err.Error(), "test.dcc: ") {
+		t.Fatalf("Expected the DCC error prefixed with the name, got %v", err)
+	}
+}
+
+func TestLoadSpriteUnsupported(t *testing.T) {
+	for _, name := range []string{"test.pcx", "test", `data\test.dc6\frame.png`} {
+		if _, err := LoadSprite(name, testDCC, testPalette()); err == nil ||
+			!strings.Contains(err.Error(), "unsupported sprite format") {
+			t.Fatalf("Expected %s to be unsupported, got %v", name, err)
+		}
+	}
+}
+
+func TestDirectionOrder(t *testing.T) {
+	expected := map[int][]int{
+		8:  {4, 0, 5, 1, 6, 2, 7, 3},
+		16: {4, 8, 0, 9, 5, 10, 1, 11, 6, 12, 2, 13, 7, 14, 3, 15},
+		32: {
+			4, 16, 8, 17, 0, 18, 9, 19, 5, 20, 10, 21, 1, 22, 11, 23,
+			6, 24, 12, 25, 2, 26, 13, 27, 7, 28, 14, 29, 3, 30, 15, 31,
+		},
+		5: {0, 1, 2, 3, 4},
+	}
+	for count, order := range expected {
+		actual := DirectionOrder(count)
+		if len(actual) != len(order) {
+			t.Fatalf("Expected %d directions, got %v", count, actual)
+		}
+		for i := range order {
+			if actual[i] != order[i] {
+				t.Fatalf("Expected the order of %d directions to be %v, got %v", count, order, actual)
+			}
+			if stored := storedDirection(i, count); stored != order[i] {
+				t.Fatalf("Expected direction %d of %d to be stored as %d, got %d", i, count, order[i], stored)
+			}
+		}
+	}
+	DirectionOrder(8)[0] = 99
+	if DirectionOrder(8)[0] != 4 {
+		t.Fatal("Expected the order to be a copy")
+	}
+	if storedDirection(8, 8) != 8 || storedDirection(-1, 8) != -1 {
+		t.Fatal("Expected directions out of range to be passed through")
+	}
+}
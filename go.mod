@@ -1,5 +1,5 @@
 module github.com/OpenDiablo2/D2Shared
 
-go 1.13
+go 1.16
 
 require github.com/JoshVarga/blast v0.0.0-20180421040937-681c804fb9f0